@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"qstreams/internal/config"
+	"qstreams/internal/storage"
+)
+
+// ConfigHandler shows the effective server configuration, with secrets redacted
+func ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":   config.Path(),
+		"config": config.Get().Redacted(),
+	})
+}
+
+// QuarantineHandler reports state files that could not be decoded and were
+// moved aside instead of being loaded
+func QuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	files, err := storage.Quarantined()
+	if err != nil {
+		http.Error(w, "Failed to read quarantine", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": files,
+	})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"qstreams/internal/connections"
+	"qstreams/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateConnectionHandler creates a named Pinot connection profile
+func CreateConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	var connection storage.Connection
+	if err := json.NewDecoder(r.Body).Decode(&connection); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := connections.Validate(&connection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := storage.LoadConnection(connection.Name); err == nil {
+		http.Error(w, "Connection already exists", http.StatusConflict)
+		return
+	}
+
+	if err := connections.Save(&connection); err != nil {
+		http.Error(w, "Failed to save connection", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Connection created successfully",
+		"name":    connection.Name,
+	})
+}
+
+// ListConnectionsHandler lists all connection profiles
+func ListConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := storage.ListConnections()
+	if err != nil {
+		http.Error(w, "Failed to list connections", http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		list[i] = storage.RedactConnection(list[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"connections": list,
+	})
+}
+
+// GetConnectionHandler returns one connection profile
+func GetConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	connection, err := storage.LoadConnection(mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(storage.RedactConnection(*connection))
+}
+
+// UpdateConnectionHandler replaces a connection profile. Running streams that
+// use it reconnect on their next tick.
+func UpdateConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	existing, err := storage.LoadConnection(name)
+	if err != nil {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	var connection storage.Connection
+	if err := json.NewDecoder(r.Body).Decode(&connection); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	connection.Name = name
+	storage.RestoreRedactedConnection(&connection, existing)
+	if err := connections.Validate(&connection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := connections.Save(&connection); err != nil {
+		http.Error(w, "Failed to save connection", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Connection updated successfully",
+		"name":    name,
+	})
+}
+
+// DeleteConnectionHandler removes a connection profile that no stream uses
+func DeleteConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, err := storage.LoadConnection(name); err != nil {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	streams, err := storage.ListStreams()
+	if err != nil {
+		http.Error(w, "Failed to list streams", http.StatusInternalServerError)
+		return
+	}
+	for _, stream := range streams {
+		if stream.Pinot.Connection == name {
+			http.Error(w, "Connection is used by stream "+stream.StreamID, http.StatusConflict)
+			return
+		}
+	}
+
+	if err := connections.Delete(name); err != nil {
+		http.Error(w, "Failed to delete connection", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Connection deleted successfully",
+		"name":    name,
+	})
+}
+
+// TestConnectionHandler checks that a profile's broker and controller are
+// reachable. The optional table query parameter also runs broker discovery.
+func TestConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	connection, err := storage.LoadConnection(mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := connections.Test(ctx, connection, r.URL.Query().Get("table"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -2,11 +2,28 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"qstreams/internal/auth"
+	"qstreams/internal/cloudevents"
+	"qstreams/internal/compress"
+	"qstreams/internal/config"
+	"qstreams/internal/connections"
 	"qstreams/internal/core"
+	"qstreams/internal/destinations"
+	"qstreams/internal/format"
+	"qstreams/internal/httpclient"
 	"qstreams/internal/metrics"
 	"qstreams/internal/models"
+	"qstreams/internal/pinot"
+	"qstreams/internal/status"
 	"qstreams/internal/storage"
+	"qstreams/shared/signature"
+	"qstreams/shared/utils"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -20,9 +37,20 @@ func CreateStreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Apply the connection profile before validating the Pinot settings
+	resolved, err := connections.Resolve(stream.Pinot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Validate Pinot configuration
-	if stream.Pinot.Query == "" || stream.Pinot.BrokerURL == "" {
-		http.Error(w, "pinot.query and pinot.broker_url are required", http.StatusBadRequest)
+	if stream.Pinot.Query == "" || (resolved.BrokerURL == "" && resolved.ControllerURL == "") {
+		http.Error(w, "pinot.query and one of pinot.broker_url, pinot.controller_url or pinot.connection are required", http.StatusBadRequest)
+		return
+	}
+	if err := validateDiscovery(resolved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if stream.Pinot.QueryInterval <= 0 {
@@ -30,16 +58,74 @@ func CreateStreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate Pagination and Chunking configuration
+	if err := validatePagination(stream.Pinot.Query, stream.Pinot.Pagination, stream.Chunking); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := pinot.ValidateOptions(resolved.Options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePartialResults(stream.Pinot.PartialResults); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if stream.Pinot.Thresholds.SlowQueryMs < 0 || stream.Pinot.Thresholds.MaxDocsScanned < 0 {
+		http.Error(w, "pinot.thresholds must not be negative", http.StatusBadRequest)
+		return
+	}
+
 	// Validate Destination configuration
-	if stream.Destination.Type == "" || stream.Destination.URL == "" {
-		http.Error(w, "destination.type and destination.url are required", http.StatusBadRequest)
+	if stream.Destination.Type == "" {
+		http.Error(w, "destination.type is required", http.StatusBadRequest)
+		return
+	}
+	if err := destinations.Validate(stream.Destination); err != nil {
+		http.Error(w, "destination: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateFormat(stream.Destination); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCompression(stream.Destination); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCloudEvents(stream.Destination.CloudEvents); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := utils.ParseLevel(stream.LogLevel); err != nil {
+		http.Error(w, "log_level: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate Authentication configuration
+	if err := validateAuth(resolved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate TLS configuration
+	if err := validateTLS(resolved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate Signing configuration
+	if err := validateSigning(stream.Destination.Signing); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Validate Dedupe configuration
 	if stream.Dedupe.Enabled {
-		if stream.Dedupe.Duration < 1000 || stream.Dedupe.Duration > 60000 {
-			http.Error(w, "dedupe.duration must be between 1000ms and 60000ms", http.StatusBadRequest)
+		bounds := config.Get().Dedupe
+		minMs, maxMs := time.Duration(bounds.MinDuration).Milliseconds(), time.Duration(bounds.MaxDuration).Milliseconds()
+		if int64(stream.Dedupe.Duration) < minMs || int64(stream.Dedupe.Duration) > maxMs {
+			http.Error(w, fmt.Sprintf("dedupe.duration must be between %dms and %dms", minMs, maxMs), http.StatusBadRequest)
 			return
 		}
 	}
@@ -51,11 +137,16 @@ func CreateStreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message":  "Stream created successfully",
+	response := map[string]string{
+		"message":   "Stream created successfully",
 		"stream_id": stream.StreamID,
-	})
+	}
+	if stream.Destination.Signing.Enabled {
+		response["signing_secret"] = stream.Destination.Signing.Secrets[0]
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
 }
 
 // StartStreamHandler starts a stopped stream
@@ -83,7 +174,7 @@ func StartStreamHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message":  "Stream started successfully",
+		"message":   "Stream started successfully",
 		"stream_id": stream.StreamID,
 	})
 }
@@ -110,7 +201,7 @@ func StopStreamHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message":  "Stream stopped successfully",
+		"message":   "Stream stopped successfully",
 		"stream_id": stream.StreamID,
 	})
 }
@@ -130,16 +221,110 @@ func UpdateStreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep stored credentials the client sent back redacted
+	storage.RestoreRedactedStream(&updatedStream, stream)
+
 	// Merge updated fields
 	stream.Name = updatedStream.Name
 	stream.Pinot.Query = updatedStream.Pinot.Query
+	stream.Pinot.Connection = updatedStream.Pinot.Connection
 	stream.Pinot.BrokerURL = updatedStream.Pinot.BrokerURL
+	stream.Pinot.ControllerURL = updatedStream.Pinot.ControllerURL
+	stream.Pinot.Discovery = updatedStream.Pinot.Discovery
 	stream.Pinot.QueryInterval = updatedStream.Pinot.QueryInterval
 	stream.Pinot.Authentication = updatedStream.Pinot.Authentication
+	stream.Pinot.Auth = updatedStream.Pinot.Auth
+	stream.Pinot.TLS = updatedStream.Pinot.TLS
+	stream.Pinot.Pagination = updatedStream.Pinot.Pagination
+	stream.Pinot.Options = updatedStream.Pinot.Options
+	stream.Pinot.PartialResults = updatedStream.Pinot.PartialResults
+	stream.Pinot.Thresholds = updatedStream.Pinot.Thresholds
+	stream.LogLevel = updatedStream.LogLevel
+	stream.Chunking = updatedStream.Chunking
 
 	stream.Destination.Type = updatedStream.Destination.Type
 	stream.Destination.URL = updatedStream.Destination.URL
 	stream.Destination.Authentication = updatedStream.Destination.Authentication
+	stream.Destination.Auth = updatedStream.Destination.Auth
+	stream.Destination.TLS = updatedStream.Destination.TLS
+	stream.Destination.Options = updatedStream.Destination.Options
+	stream.Destination.Format = updatedStream.Destination.Format
+	stream.Destination.Compression = updatedStream.Destination.Compression
+	stream.Destination.Template = updatedStream.Destination.Template
+	stream.Destination.CloudEvents = updatedStream.Destination.CloudEvents
+
+	resolved, err := connections.Resolve(stream.Pinot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if resolved.BrokerURL == "" && resolved.ControllerURL == "" {
+		http.Error(w, "one of pinot.broker_url, pinot.controller_url or pinot.connection is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateDiscovery(resolved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateAuth(resolved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateTLS(resolved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePagination(stream.Pinot.Query, stream.Pinot.Pagination, stream.Chunking); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := pinot.ValidateOptions(resolved.Options); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePartialResults(stream.Pinot.PartialResults); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if stream.Pinot.Thresholds.SlowQueryMs < 0 || stream.Pinot.Thresholds.MaxDocsScanned < 0 {
+		http.Error(w, "pinot.thresholds must not be negative", http.StatusBadRequest)
+		return
+	}
+	if err := destinations.Validate(stream.Destination); err != nil {
+		http.Error(w, "destination: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateFormat(stream.Destination); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCompression(stream.Destination); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCloudEvents(stream.Destination.CloudEvents); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := utils.ParseLevel(stream.LogLevel); err != nil {
+		http.Error(w, "log_level: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSigning(updatedStream.Destination.Signing); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	signing := updatedStream.Destination.Signing
+	if signing.Enabled && len(signing.Secrets) == 0 {
+		// Keep the current secrets when signing is left enabled without new ones
+		signing.Secrets = stream.Destination.Signing.Secrets
+	}
+	if err := core.EnsureSigningSecret(&signing); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stream.Destination.Signing = signing
 
 	stream.Dedupe = updatedStream.Dedupe
 
@@ -148,10 +333,12 @@ func UpdateStreamHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to update stream", http.StatusInternalServerError)
 		return
 	}
+	// Level changes apply to the running worker straight away
+	utils.SetStreamLevel(stream.StreamID, stream.LogLevel)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message":  "Stream updated successfully",
+		"message":   "Stream updated successfully",
 		"stream_id": stream.StreamID,
 	})
 }
@@ -159,19 +346,21 @@ func UpdateStreamHandler(w http.ResponseWriter, r *http.Request) {
 // DeleteStreamHandler deletes an existing stream
 func DeleteStreamHandler(w http.ResponseWriter, r *http.Request) {
 	streamID := mux.Vars(r)["stream_id"]
-	filePath := storage.GetStreamFilePath(streamID)
 
-	if err := storage.DeleteStreamFile(filePath); err != nil {
+	if err := storage.DeleteStream(streamID); err != nil {
 		http.Error(w, "Failed to delete stream", http.StatusInternalServerError)
 		return
 	}
 
 	// Optionally clean up metrics
 	metrics.DeleteMetricsForStream(streamID)
+	status.Delete(streamID)
+	metrics.DeleteStats(streamID)
+	utils.DeleteStreamLogs(streamID)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message":  "Stream deleted successfully",
+		"message":   "Stream deleted successfully",
 		"stream_id": streamID,
 	})
 }
@@ -184,14 +373,242 @@ func ListStreamsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Directly encode the list of QueryStream models
+	// Never return credentials
+	type streamWithStatus struct {
+		storage.QueryStream
+		Status *models.StreamStatus `json:"status,omitempty"`
+	}
+	listed := make([]streamWithStatus, len(streams))
+	for i, stream := range streams {
+		listed[i].QueryStream = storage.RedactStream(stream)
+		if current, ok := streamStatus(stream); ok {
+			listed[i].Status = &current
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"streams": streams,
+		"streams": listed,
 	})
 }
 
+// streamStatus returns the runtime status of a stream. A stopped stream has
+// no next run.
+func streamStatus(stream storage.QueryStream) (models.StreamStatus, bool) {
+	current, ok := status.Get(stream.StreamID)
+	current.StreamID = stream.StreamID
+	if stream.State != "running" {
+		current.NextRunAt = nil
+	}
+	return current, ok
+}
+
+// StreamStatusHandler reports the runtime status of a stream's worker
+func StreamStatusHandler(w http.ResponseWriter, r *http.Request) {
+	streamID := mux.Vars(r)["stream_id"]
+	stream, err := storage.LoadStream(streamID)
+	if err != nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	current, _ := streamStatus(*stream)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stream_id": stream.StreamID,
+		"name":      stream.Name,
+		"state":     stream.State,
+		"status":    current,
+	})
+}
+
+// StreamStatsHandler reports the query cost statistics of a stream
+func StreamStatsHandler(w http.ResponseWriter, r *http.Request) {
+	streamID := mux.Vars(r)["stream_id"]
+	stream, err := storage.LoadStream(streamID)
+	if err != nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stream_id":  stream.StreamID,
+		"name":       stream.Name,
+		"thresholds": stream.Pinot.Thresholds,
+		"stats":      metrics.QueryStats(streamID),
+		"recent":     metrics.RecentQueries(streamID, 20),
+	})
+}
+
+// StreamDeliveriesHandler returns the most recent deliveries of a stream, newest first
+func StreamDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	streamID := mux.Vars(r)["stream_id"]
+	if _, err := storage.LoadStream(streamID); err != nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > storage.MaxDeliveries {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", storage.MaxDeliveries), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := storage.ListDeliveries(streamID, limit)
+	if err != nil {
+		http.Error(w, "Failed to read deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stream_id":  streamID,
+		"deliveries": deliveries,
+	})
+}
+
+// StreamLogsHandler returns the most recent log lines of a stream, oldest
+// first, optionally only those at or above ?level=
+func StreamLogsHandler(w http.ResponseWriter, r *http.Request) {
+	streamID := mux.Vars(r)["stream_id"]
+	if _, err := storage.LoadStream(streamID); err != nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	minLevel := slog.LevelDebug
+	if value := r.URL.Query().Get("level"); value != "" {
+		parsed, err := utils.ParseLevel(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		minLevel = parsed
+	}
+
+	// Filter before applying the limit so it counts matching lines
+	entries := utils.StreamLogs(streamID, 0)
+	logs := []utils.LogEntry{}
+	for _, entry := range entries {
+		if level, err := utils.ParseLevel(entry.Level); err == nil && level >= minLevel {
+			logs = append(logs, entry)
+		}
+	}
+	if limit > 0 && len(logs) > limit {
+		logs = logs[len(logs)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stream_id": streamID,
+		"logs":      logs,
+	})
+}
+
+// DestinationTypesHandler lists the registered destination types and their options
+func DestinationTypesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"types": destinations.Types(),
+	})
+}
+
+// maxHistorySamples bounds the number of steps a history query may return
+const maxHistorySamples = 10000
+
+// StreamMetricsHistoryHandler returns a stream's metrics per step between
+// ?from= and ?to= (RFC 3339 or Unix seconds; the last hour by default).
+// Steps default to a minute, or an hour once the range reaches past the
+// per-minute retention, where only hourly steps are available.
+func StreamMetricsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	streamID := mux.Vars(r)["stream_id"]
+	if _, err := storage.LoadStream(streamID); err != nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	to, err := parseTime(r.URL.Query().Get("to"), now)
+	if err != nil {
+		http.Error(w, "to must be an RFC 3339 time or Unix seconds", http.StatusBadRequest)
+		return
+	}
+	from, err := parseTime(r.URL.Query().Get("from"), to.Add(-time.Hour))
+	if err != nil {
+		http.Error(w, "from must be an RFC 3339 time or Unix seconds", http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	minuteRetention := time.Duration(config.Get().Metrics.MinuteRetention)
+	hourly := from.Before(now.Add(-minuteRetention))
+	step := time.Minute
+	if hourly {
+		step = time.Hour
+	}
+	if value := r.URL.Query().Get("step"); value != "" {
+		step, err = time.ParseDuration(value)
+		if err != nil || step < time.Minute || step%time.Minute != 0 {
+			http.Error(w, "step must be a whole number of minutes, such as 5m or 1h", http.StatusBadRequest)
+			return
+		}
+		if hourly && step%time.Hour != 0 {
+			http.Error(w, fmt.Sprintf("step must be a whole number of hours for data older than %s", minuteRetention), http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Sub(from)/step > maxHistorySamples {
+		http.Error(w, fmt.Sprintf("from, to and step must cover at most %d steps", maxHistorySamples), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stream_id": streamID,
+		"from":      from,
+		"to":        to,
+		"step":      step.String(),
+		"samples":   metrics.HistorySamples(streamID, from, to, step),
+	})
+}
+
+// parseTime parses an RFC 3339 time or Unix seconds, returning fallback when
+// value is empty
+func parseTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // MetricsHandler handles the /metrics endpoint to expose metrics for all streams
 func MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	metrics.Cache.Lock()
@@ -204,14 +621,147 @@ func MetricsHandler(w http.ResponseWriter, r *http.Request) {
 
 	for streamID, metricsData := range metrics.Cache.Data {
 		response.Streams = append(response.Streams, models.StreamMetrics{
-			StreamID:       streamID,
-			EventsSent:     metricsData.EventsSent,
-			EventsDeduped:  metricsData.EventsDeduped,
-			NumberOfQueries: metricsData.NumberOfQueries,
+			StreamID:               streamID,
+			EventsSent:             metricsData.EventsSent,
+			EventsDeduped:          metricsData.EventsDeduped,
+			NumberOfQueries:        metricsData.NumberOfQueries,
+			BytesBeforeCompression: metricsData.BytesBeforeCompression,
+			BytesAfterCompression:  metricsData.BytesAfterCompression,
+			QueryErrors:            metricsData.QueryErrors,
+			PartialResults:         metricsData.PartialResults,
+			DeliveryErrors:         metricsData.DeliveryErrors,
+			Retries:                metricsData.Retries,
+			ErrorsByClass:          metricsData.ErrorsByClass,
+			QueryStats:             metrics.QueryStats(streamID),
 		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+// validateAuth checks that the Pinot auth config can build a provider
+func validateAuth(pinot storage.PinotConfig) error {
+	if _, err := auth.NewProvider(pinot.Authentication, pinot.Auth, nil); err != nil {
+		return fmt.Errorf("pinot.%v", err)
+	}
+	return nil
+}
+
+// validateTLS checks that the TLS files for Pinot can be loaded
+func validateTLS(pinot storage.PinotConfig) error {
+	if _, err := httpclient.New(pinot.TLS); err != nil {
+		return fmt.Errorf("pinot.%v", err)
+	}
+	return nil
+}
+
+// validateDiscovery checks that brokers can be discovered for the stream's table
+func validateDiscovery(pinotConfig storage.PinotConfig) error {
+	if pinotConfig.ControllerURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(pinotConfig.ControllerURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("pinot.controller_url must be an absolute http(s) URL")
+	}
+	if pinotConfig.Discovery.Table == "" && pinot.TableFromQuery(pinotConfig.Query) == "" {
+		return fmt.Errorf("pinot.discovery.table is required when the table cannot be read from the query")
+	}
+	if pinotConfig.Discovery.RefreshInterval < 0 {
+		return fmt.Errorf("pinot.discovery.refresh_interval must not be negative")
+	}
+	return nil
+}
+
+// validatePartialResults checks the partial result policy of a stream
+func validatePartialResults(policy string) error {
+	switch policy {
+	case "", "drop", "deliver":
+		return nil
+	default:
+		return fmt.Errorf("pinot.partial_results must be 'drop' or 'deliver'")
+	}
+}
+
+// validatePagination checks the paging and chunking limits of a stream
+func validatePagination(query string, pagination storage.PaginationConfig, chunking storage.ChunkingConfig) error {
+	switch pagination.Mode {
+	case "", "offset", "cursor":
+	default:
+		return fmt.Errorf("pinot.pagination.mode must be 'offset' or 'cursor'")
+	}
+	if pagination.PageSize < 0 || pagination.MaxRows < 0 {
+		return fmt.Errorf("pinot.pagination.page_size and pinot.pagination.max_rows must not be negative")
+	}
+	// Offset pages without a bound would read the whole table on every tick
+	if pagination.Enabled && pagination.Mode != "cursor" && pagination.MaxRows == 0 {
+		if _, _, limit := pinot.SplitLimit(query); limit == 0 {
+			return fmt.Errorf("pinot.pagination.max_rows or a LIMIT in pinot.query is required for offset pagination")
+		}
+	}
+	if chunking.Rows < 0 || chunking.Bytes < 0 {
+		return fmt.Errorf("chunking.rows and chunking.bytes must not be negative")
+	}
+	return nil
+}
+
+// validateFormat checks the payload format and renders any templates against a sample result
+func validateFormat(destination storage.DestinationConfig) error {
+	encoder, headerTemplates, err := format.NewEncoder(destination)
+	if err != nil {
+		return fmt.Errorf("destination: %v", err)
+	}
+
+	sample := format.SampleResult()
+	if destination.Template.Body != "" {
+		if _, err := encoder.Encode(sample); err != nil {
+			return fmt.Errorf("destination.template.body: %v", err)
+		}
+	}
+	if headerTemplates != nil {
+		if _, err := headerTemplates.Render(sample); err != nil {
+			return fmt.Errorf("destination.template.headers: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateCompression checks the compression settings against what the destination supports
+func validateCompression(destination storage.DestinationConfig) error {
+	compression := destination.Compression
+	if err := compress.Validate(compression.Algorithm, compression.Level); err != nil {
+		return fmt.Errorf("destination.compression: %v", err)
+	}
+	if compression.MinBytes < 0 {
+		return fmt.Errorf("destination.compression.min_bytes must not be negative")
+	}
+	if compression.Algorithm != "" && !destinations.SupportsCompression(destination.Type, compression.Algorithm) {
+		return fmt.Errorf("destination.compression: %s destinations do not support %s", destination.Type, compression.Algorithm)
+	}
+	return nil
+}
+
+// validateCloudEvents checks the CloudEvents envelope settings
+func validateCloudEvents(config storage.CloudEventsConfig) error {
+	switch config.Mode {
+	case "", cloudevents.ModeStructured, cloudevents.ModeBinary:
+	default:
+		return fmt.Errorf("destination.cloudevents.mode must be 'structured' or 'binary'")
+	}
+	return nil
+}
+
+// validateSigning checks the signing secrets supplied for a destination
+func validateSigning(signing storage.SigningConfig) error {
+	if len(signing.Secrets) > signature.MaxSecrets {
+		return fmt.Errorf("destination.signing.secrets accepts at most %d secrets", signature.MaxSecrets)
+	}
+	for _, secret := range signing.Secrets {
+		if secret == "" {
+			return fmt.Errorf("destination.signing.secrets must not contain empty secrets")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"qstreams/internal/health"
+)
+
+// HealthzHandler reports that the process is up
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// ReadyzHandler reports whether the state store, metrics and streams have
+// been loaded, answering 503 until they have
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ready, steps := health.Ready()
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready": ready,
+		"steps": steps,
+	})
+}
+
+// DependenciesHandler probes the Pinot brokers, controllers and destination
+// hosts of running streams. The status is "degraded" when any is unhealthy;
+// the response code stays 200 so it is not mistaken for a qstreams failure.
+func DependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	dependencies, err := health.Dependencies(ctx)
+	if err != nil {
+		http.Error(w, "Failed to list streams", http.StatusInternalServerError)
+		return
+	}
+	status := "ok"
+	for _, dependency := range dependencies {
+		if !dependency.Healthy {
+			status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       status,
+		"dependencies": dependencies,
+	})
+}
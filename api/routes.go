@@ -1,17 +1,42 @@
 package api
 
 import (
+	"qstreams/internal/health"
+	"qstreams/internal/metrics"
+
 	"github.com/gorilla/mux"
 )
 
 func InitRoutes() *mux.Router {
-	router := mux.NewRouter()
+	root := mux.NewRouter()
+	root.HandleFunc("/healthz", HealthzHandler).Methods("GET")
+	root.HandleFunc("/readyz", ReadyzHandler).Methods("GET")
+	root.HandleFunc("/health/dependencies", DependenciesHandler).Methods("GET")
+
+	// The API answers 503 until the server is ready
+	router := root.PathPrefix("/").Subrouter()
+	router.Use(health.WhenReady)
 	router.HandleFunc("/streams", CreateStreamHandler).Methods("POST")
 	router.HandleFunc("/streams/{stream_id}/start", StartStreamHandler).Methods("POST")
 	router.HandleFunc("/streams/{stream_id}/stop", StopStreamHandler).Methods("POST")
 	router.HandleFunc("/streams/{stream_id}", DeleteStreamHandler).Methods("DELETE")
 	router.HandleFunc("/streams/{stream_id}", UpdateStreamHandler).Methods("PUT")
 	router.HandleFunc("/streams", ListStreamsHandler).Methods("GET")
+	router.HandleFunc("/streams/{stream_id}/status", StreamStatusHandler).Methods("GET")
+	router.HandleFunc("/streams/{stream_id}/stats", StreamStatsHandler).Methods("GET")
+	router.HandleFunc("/streams/{stream_id}/deliveries", StreamDeliveriesHandler).Methods("GET")
+	router.HandleFunc("/streams/{stream_id}/logs", StreamLogsHandler).Methods("GET")
+	router.HandleFunc("/streams/{stream_id}/metrics", StreamMetricsHistoryHandler).Methods("GET")
+	router.HandleFunc("/connections", CreateConnectionHandler).Methods("POST")
+	router.HandleFunc("/connections", ListConnectionsHandler).Methods("GET")
+	router.HandleFunc("/connections/{name}", GetConnectionHandler).Methods("GET")
+	router.HandleFunc("/connections/{name}", UpdateConnectionHandler).Methods("PUT")
+	router.HandleFunc("/connections/{name}", DeleteConnectionHandler).Methods("DELETE")
+	router.HandleFunc("/connections/{name}/test", TestConnectionHandler).Methods("POST")
+	router.HandleFunc("/destinations/types", DestinationTypesHandler).Methods("GET")
 	router.HandleFunc("/metrics", MetricsHandler).Methods("GET")
-	return router
-}
\ No newline at end of file
+	router.Handle("/metrics/prometheus", metrics.PrometheusHandler()).Methods("GET")
+	router.HandleFunc("/admin/config", ConfigHandler).Methods("GET")
+	router.HandleFunc("/admin/quarantine", QuarantineHandler).Methods("GET")
+	return root
+}
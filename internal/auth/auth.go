@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"qstreams/internal/secrets"
+	"qstreams/internal/storage"
+)
+
+// Provider attaches credentials to an outbound HTTP request
+type Provider interface {
+	Apply(req *http.Request) error
+}
+
+// Invalidator is implemented by providers that cache credentials
+type Invalidator interface {
+	// Invalidate drops the cached credentials so the next request fetches new ones
+	Invalidate()
+}
+
+// Rejected drops a provider's cached credentials when the server answered 401
+func Rejected(provider Provider, resp *http.Response) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return
+	}
+	if invalidator, ok := provider.(Invalidator); ok {
+		invalidator.Invalidate()
+	}
+}
+
+// ProviderFunc adapts a function to the Provider interface
+type ProviderFunc func(req *http.Request) error
+
+func (f ProviderFunc) Apply(req *http.Request) error {
+	return f(req)
+}
+
+// NewProvider builds a Provider from the legacy static header map and an
+// optional auth config. Static headers are applied first so an auth provider
+// can override a stale Authorization header left in the map. client carries
+// the TLS settings used to reach an OAuth2 token endpoint; when nil a client
+// with the default timeout is used.
+func NewProvider(headers map[string]string, config *storage.AuthConfig, client *http.Client) (Provider, error) {
+	providers := []Provider{}
+	if len(headers) > 0 {
+		if err := checkReferences(headers); err != nil {
+			return nil, err
+		}
+		providers = append(providers, &StaticProvider{Headers: headers})
+	}
+
+	if config != nil {
+		provider, err := newConfiguredProvider(config, client)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	return chain(providers), nil
+}
+
+func newConfiguredProvider(config *storage.AuthConfig, client *http.Client) (Provider, error) {
+	switch config.Type {
+	case "static":
+		if len(config.Headers) == 0 {
+			return nil, fmt.Errorf("auth.headers is required for static auth")
+		}
+		if err := checkReferences(config.Headers); err != nil {
+			return nil, err
+		}
+		return &StaticProvider{Headers: config.Headers}, nil
+	case "basic":
+		if config.Username == "" {
+			return nil, fmt.Errorf("auth.username is required for basic auth")
+		}
+		if err := checkReferences(map[string]string{"username": config.Username, "password": config.Password}); err != nil {
+			return nil, err
+		}
+		return &BasicProvider{Username: config.Username, Password: config.Password}, nil
+	case "oauth2":
+		if err := secrets.CheckReferences(config.ClientSecret); err != nil {
+			return nil, fmt.Errorf("auth.client_secret: %w", err)
+		}
+		return NewClientCredentialsProvider(config, client)
+	case "file":
+		return NewTokenFileProvider(config)
+	default:
+		return nil, fmt.Errorf("auth.type %q is not supported", config.Type)
+	}
+}
+
+// checkReferences rejects secret references Resolve would refuse, so they
+// fail when the stream is saved rather than on every request
+func checkReferences(values map[string]string) error {
+	for name, value := range values {
+		if err := secrets.CheckReferences(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+type chain []Provider
+
+func (c chain) Apply(req *http.Request) error {
+	for _, provider := range c {
+		if err := provider.Apply(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c chain) Invalidate() {
+	for _, provider := range c {
+		if invalidator, ok := provider.(Invalidator); ok {
+			invalidator.Invalidate()
+		}
+	}
+}
+
+// StaticProvider sets a fixed set of headers
+type StaticProvider struct {
+	Headers map[string]string
+}
+
+func (p *StaticProvider) Apply(req *http.Request) error {
+	for key, value := range p.Headers {
+		resolved, err := secrets.Resolve(value)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(key, resolved)
+	}
+	return nil
+}
+
+// BasicProvider sets HTTP basic authentication credentials
+type BasicProvider struct {
+	Username string
+	Password string
+}
+
+func (p *BasicProvider) Apply(req *http.Request) error {
+	username, err := secrets.Resolve(p.Username)
+	if err != nil {
+		return err
+	}
+	password, err := secrets.Resolve(p.Password)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+	return nil
+}
+
+// setToken writes a bearer token into the configured header
+func setToken(req *http.Request, config *storage.AuthConfig, token string) {
+	header := config.HeaderName
+	if header == "" {
+		header = "Authorization"
+	}
+	scheme := config.Scheme
+	if scheme == "" && header == "Authorization" {
+		scheme = "Bearer"
+	}
+	if scheme != "" {
+		token = scheme + " " + token
+	}
+	req.Header.Set(header, token)
+}
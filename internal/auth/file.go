@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"qstreams/internal/secrets"
+	"qstreams/internal/storage"
+)
+
+// TokenFileProvider reads a bearer token from a file, such as a projected
+// Kubernetes service account token, and re-reads it whenever the file changes.
+// The file must lie inside the secrets reference directory.
+type TokenFileProvider struct {
+	config *storage.AuthConfig
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func NewTokenFileProvider(config *storage.AuthConfig) (*TokenFileProvider, error) {
+	if config.TokenFile == "" {
+		return nil, fmt.Errorf("auth.token_file is required for file auth")
+	}
+	if _, err := secrets.CheckFile(config.TokenFile); err != nil {
+		return nil, fmt.Errorf("auth.token_file: %w", err)
+	}
+	return &TokenFileProvider{config: config}, nil
+}
+
+func (p *TokenFileProvider) Apply(req *http.Request) error {
+	token, err := p.Token()
+	if err != nil {
+		return err
+	}
+	setToken(req, p.config, token)
+	return nil
+}
+
+// Token returns the current token, reloading the file if it has changed
+// since it was last read.
+func (p *TokenFileProvider) Token() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	path, err := secrets.CheckFile(p.config.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if p.token != "" {
+			// Keep serving the last good token while the file is being replaced
+			return p.token, nil
+		}
+		return "", fmt.Errorf("failed to stat token file: %w", err)
+	}
+
+	if p.token != "" && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.token, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", p.config.TokenFile)
+	}
+
+	p.token = token
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	return p.token, nil
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"qstreams/internal/httpclient"
+	"qstreams/internal/secrets"
+	"qstreams/internal/storage"
+)
+
+// refreshSkew refreshes tokens slightly before they expire so an in-flight
+// request never carries a token that lapses on the way to the server.
+const refreshSkew = 30 * time.Second
+
+// ClientCredentialsProvider fetches bearer tokens with the OAuth2 client
+// credentials grant and caches them until shortly before they expire.
+type ClientCredentialsProvider struct {
+	config *storage.AuthConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	// refreshing is the token request in flight; concurrent callers wait
+	// for it instead of each calling the token endpoint
+	refreshing *refresh
+}
+
+// refresh is a token request shared by the callers waiting on done
+type refresh struct {
+	done chan struct{}
+	err  error
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func NewClientCredentialsProvider(config *storage.AuthConfig, client *http.Client) (*ClientCredentialsProvider, error) {
+	if config.TokenURL == "" || config.ClientID == "" || config.ClientSecret == "" {
+		return nil, fmt.Errorf("auth.token_url, auth.client_id and auth.client_secret are required for oauth2 auth")
+	}
+	if _, err := url.ParseRequestURI(config.TokenURL); err != nil {
+		return nil, fmt.Errorf("auth.token_url is invalid: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: httpclient.DefaultTimeout}
+	}
+	return &ClientCredentialsProvider{config: config, client: client}, nil
+}
+
+func (p *ClientCredentialsProvider) Apply(req *http.Request) error {
+	token, err := p.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	setToken(req, p.config, token)
+	return nil
+}
+
+// Token returns the cached access token, fetching a new one if it is missing
+// or about to expire. The lock is not held during the request, and a caller
+// whose ctx is cancelled stops waiting for it.
+func (p *ClientCredentialsProvider) Token(ctx context.Context) (string, error) {
+	for {
+		p.mu.Lock()
+		if p.token != "" && time.Now().Before(p.expires.Add(-refreshSkew)) {
+			token := p.token
+			p.mu.Unlock()
+			return token, nil
+		}
+
+		if pending := p.refreshing; pending != nil {
+			// Another caller is fetching a token; wait for it and check again
+			p.mu.Unlock()
+			select {
+			case <-pending.done:
+				// A refresh abandoned by its caller's context is retried
+				// with this caller's own
+				if pending.err != nil && !errors.Is(pending.err, context.Canceled) && !errors.Is(pending.err, context.DeadlineExceeded) {
+					return "", pending.err
+				}
+				continue
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+
+		current := &refresh{done: make(chan struct{})}
+		p.refreshing = current
+		p.mu.Unlock()
+
+		token, expires, err := p.fetch(ctx)
+
+		p.mu.Lock()
+		if err == nil {
+			p.token = token
+			p.expires = expires
+		}
+		p.refreshing = nil
+		p.mu.Unlock()
+		current.err = err
+		close(current.done)
+		return token, err
+	}
+}
+
+// Invalidate drops the cached token after the server rejected it
+func (p *ClientCredentialsProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.token = ""
+	p.expires = time.Time{}
+}
+
+func (p *ClientCredentialsProvider) fetch(ctx context.Context) (string, time.Time, error) {
+	// Secret references are resolved for every token request
+	clientSecret, err := secrets.Resolve(p.config.ClientSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(p.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(p.config.Scopes, " "))
+	}
+	for key, value := range p.config.EndpointParams {
+		form.Set(key, value)
+	}
+	if p.config.ClientAuth == "body" {
+		form.Set("client_id", p.config.ClientID)
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientAuth != "body" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to fetch oauth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response did not contain an access_token")
+	}
+
+	expires := time.Now().Add(time.Hour)
+	if body.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return body.AccessToken, expires, nil
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qstreams/internal/storage"
+)
+
+func tokenServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if handler != nil {
+			handler(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600}`, n)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func clientCredentials(t *testing.T, tokenURL string, client *http.Client) *ClientCredentialsProvider {
+	t.Helper()
+	provider, err := NewClientCredentialsProvider(&storage.AuthConfig{
+		Type:         "oauth2",
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+	}, client)
+	if err != nil {
+		t.Fatalf("NewClientCredentialsProvider: %v", err)
+	}
+	return provider
+}
+
+func TestClientCredentialsUsesGivenClient(t *testing.T) {
+	server, _ := tokenServer(t, nil)
+
+	// The default client does not trust the test server's certificate
+	if _, err := clientCredentials(t, server.URL, nil).Token(context.Background()); err == nil {
+		t.Fatalf("Token() with the default client succeeded against an untrusted certificate")
+	}
+	token, err := clientCredentials(t, server.URL, server.Client()).Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() with the server's client: %v", err)
+	}
+	if token != "token-1" {
+		t.Errorf("Token() = %q, want %q", token, "token-1")
+	}
+}
+
+func TestClientCredentialsRefetchesAfter401(t *testing.T) {
+	server, requests := tokenServer(t, nil)
+	p, err := NewProvider(map[string]string{"X-Static": "1"}, &storage.AuthConfig{
+		Type:         "oauth2",
+		TokenURL:     server.URL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+
+	apply := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/query/sql", nil)
+		if err := p.Apply(req); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	if got := apply(); got != "Bearer token-1" {
+		t.Fatalf("Authorization = %q, want %q", got, "Bearer token-1")
+	}
+	Rejected(p, &http.Response{StatusCode: http.StatusOK})
+	if got := apply(); got != "Bearer token-1" {
+		t.Errorf("Authorization after a 200 = %q, want the cached token", got)
+	}
+	Rejected(p, &http.Response{StatusCode: http.StatusUnauthorized})
+	if got := apply(); got != "Bearer token-2" {
+		t.Errorf("Authorization after a 401 = %q, want %q", got, "Bearer token-2")
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("token endpoint called %d times, want 2", n)
+	}
+}
+
+func TestClientCredentialsContext(t *testing.T) {
+	release := make(chan struct{})
+	server, requests := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			fmt.Fprint(w, `{"access_token":"slow","expires_in":3600}`)
+		case <-r.Context().Done():
+		}
+	})
+	provider := clientCredentials(t, server.URL, server.Client())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Token() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The lock is not held while a token is fetched, so a waiting caller can
+	// give up on its own context
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		provider.Token(context.Background())
+	}()
+	for atomic.LoadInt32(requests) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting Token() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	<-done
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("token endpoint called %d times, want 2", n)
+	}
+}
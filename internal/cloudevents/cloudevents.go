@@ -0,0 +1,147 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	// StructuredContentType is the media type of structured-mode JSON events
+	StructuredContentType = "application/cloudevents+json"
+
+	ModeStructured = "structured"
+	ModeBinary     = "binary"
+)
+
+// Event holds the CloudEvents context attributes and data of one delivery
+type Event struct {
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	Data            []byte
+	// Extensions are additional context attributes, e.g. chunk position
+	Extensions map[string]string
+}
+
+var (
+	instanceOnce sync.Once
+	instance     string
+)
+
+// Instance identifies this qstreams process in event sources. It is taken
+// from QSTREAMS_INSTANCE when set, otherwise from the host name.
+func Instance() string {
+	instanceOnce.Do(func() {
+		instance = os.Getenv("QSTREAMS_INSTANCE")
+		if instance == "" {
+			instance, _ = os.Hostname()
+		}
+		if instance == "" {
+			instance = "qstreams"
+		}
+	})
+	return instance
+}
+
+// Source returns the default source for events emitted by a stream
+func Source(streamID string) string {
+	return fmt.Sprintf("/qstreams/%s/streams/%s", Instance(), streamID)
+}
+
+var invalidTypeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Type returns the default event type for a stream name
+func Type(streamName string) string {
+	name := strings.Trim(invalidTypeChars.ReplaceAllString(strings.ToLower(streamName), "-"), "-")
+	if name == "" {
+		name = "stream"
+	}
+	return "io.qstreams." + name
+}
+
+// Attributes returns the event's context attributes keyed by attribute name
+func (e Event) Attributes() map[string]string {
+	attributes := map[string]string{
+		"specversion": SpecVersion,
+		"id":          e.ID,
+		"source":      e.Source,
+		"type":        e.Type,
+		"time":        e.Time.UTC().Format(time.RFC3339Nano),
+	}
+	if e.Subject != "" {
+		attributes["subject"] = e.Subject
+	}
+	if e.DataContentType != "" {
+		attributes["datacontenttype"] = e.DataContentType
+	}
+	for name, value := range e.Extensions {
+		attributes[name] = value
+	}
+	return attributes
+}
+
+// Structured encodes the event in the JSON event format. JSON data is
+// embedded as-is; any other data is carried base64 encoded in data_base64.
+func (e Event) Structured() ([]byte, error) {
+	envelope := make(map[string]interface{})
+	for name, value := range e.Attributes() {
+		envelope[name] = value
+	}
+	if isJSON(e.DataContentType) && json.Valid(e.Data) {
+		envelope["data"] = json.RawMessage(e.Data)
+	} else if len(e.Data) > 0 {
+		envelope["data_base64"] = e.Data
+	}
+	return json.Marshal(envelope)
+}
+
+// HTTPHeaders maps the event to binary-mode HTTP headers. The content type
+// is carried by the regular Content-Type header.
+func (e Event) HTTPHeaders() map[string]string {
+	return prefixed(e, "ce-", "datacontenttype")
+}
+
+// KafkaHeaders maps the event to binary-mode Kafka message headers
+func (e Event) KafkaHeaders() map[string]string {
+	headers := prefixed(e, "ce_", "datacontenttype")
+	if e.DataContentType != "" {
+		headers["content-type"] = e.DataContentType
+	}
+	return headers
+}
+
+// AMQPProperties maps the event to binary-mode AMQP application properties
+func (e Event) AMQPProperties() map[string]string {
+	properties := prefixed(e, "cloudEvents:", "datacontenttype")
+	if e.DataContentType != "" {
+		properties["content-type"] = e.DataContentType
+	}
+	return properties
+}
+
+func prefixed(e Event, prefix, skip string) map[string]string {
+	headers := make(map[string]string)
+	for name, value := range e.Attributes() {
+		if name == skip {
+			continue
+		}
+		headers[prefix+name] = value
+	}
+	return headers
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,158 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	None   = ""
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy"
+)
+
+// Algorithms lists the supported compression algorithms
+var Algorithms = []string{Gzip, Zstd, Snappy}
+
+// Level values accepted in configuration
+const (
+	LevelFastest = "fastest"
+	LevelDefault = "default"
+	LevelBest    = "best"
+)
+
+// ContentEncoding returns the HTTP Content-Encoding token for an algorithm
+func ContentEncoding(algorithm string) string {
+	switch algorithm {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		// Not a registered HTTP content coding; only used by destinations
+		// whose protocol carries the codec out of band
+		return "snappy"
+	default:
+		return ""
+	}
+}
+
+// Validate checks an algorithm and level from configuration
+func Validate(algorithm, level string) error {
+	switch algorithm {
+	case None, Gzip, Zstd, Snappy:
+	default:
+		return fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+	switch level {
+	case "", LevelFastest, LevelDefault, LevelBest:
+	default:
+		return fmt.Errorf("unsupported compression level: %s", level)
+	}
+	return nil
+}
+
+// Compress encodes data with the given algorithm and level
+func Compress(algorithm, level string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&buf, gzipLevel(level))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		encoder, err := zstdEncoder(level)
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+}
+
+// Decompress reverses Compress
+func Decompress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case None:
+		return data, nil
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case Zstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	case Snappy:
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+}
+
+func gzipLevel(level string) int {
+	switch level {
+	case LevelFastest:
+		return gzip.BestSpeed
+	case LevelBest:
+		return gzip.BestCompression
+	default:
+		return gzip.DefaultCompression
+	}
+}
+
+// zstd encoders are safe for concurrent EncodeAll calls and expensive to
+// create, so one is kept per level
+var zstdEncoders = struct {
+	sync.Mutex
+	byLevel map[string]*zstd.Encoder
+}{byLevel: make(map[string]*zstd.Encoder)}
+
+func zstdEncoder(level string) (*zstd.Encoder, error) {
+	zstdEncoders.Lock()
+	defer zstdEncoders.Unlock()
+
+	if encoder, exists := zstdEncoders.byLevel[level]; exists {
+		return encoder, nil
+	}
+
+	encoderLevel := zstd.SpeedDefault
+	switch level {
+	case LevelFastest:
+		encoderLevel = zstd.SpeedFastest
+	case LevelBest:
+		encoderLevel = zstd.SpeedBestCompression
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(encoderLevel))
+	if err != nil {
+		return nil, err
+	}
+	zstdEncoders.byLevel[level] = encoder
+	return encoder, nil
+}
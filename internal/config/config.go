@@ -0,0 +1,332 @@
+// Package config loads the server configuration from config/config.yaml.
+//
+// Settings are applied in order of precedence: built-in defaults, the YAML
+// file, QSTREAMS_* environment variables and finally command-line flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"qstreams/internal/secrets"
+	"qstreams/internal/storage"
+	"qstreams/internal/tracing"
+	"qstreams/shared/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is read when neither -config nor QSTREAMS_CONFIG is set
+const DefaultPath = "config/config.yaml"
+
+type Config struct {
+	Server  ServerConfig  `yaml:"server" json:"server"`
+	Store   StoreConfig   `yaml:"store" json:"store"`
+	Metrics MetricsConfig `yaml:"metrics" json:"metrics"`
+	HTTP    HTTPConfig    `yaml:"http" json:"http"`
+	Dedupe  DedupeConfig  `yaml:"dedupe" json:"dedupe"`
+	Secrets SecretsConfig `yaml:"secrets" json:"secrets"`
+	Logging LoggingConfig `yaml:"logging" json:"logging"`
+	Tracing TracingConfig `yaml:"tracing" json:"tracing"`
+}
+
+type ServerConfig struct {
+	Address    string `yaml:"address" json:"address"`
+	ConsoleDir string `yaml:"console_dir" json:"console_dir"`
+}
+
+type StoreConfig struct {
+	Backend string `yaml:"backend" json:"backend"`
+	Path    string `yaml:"path" json:"path"`
+}
+
+// MetricsConfig sets how often metrics are persisted and how long their
+// per-minute and hourly history is kept
+type MetricsConfig struct {
+	FlushInterval   Duration `yaml:"flush_interval" json:"flush_interval"`
+	MinuteRetention Duration `yaml:"minute_retention" json:"minute_retention"`
+	HourRetention   Duration `yaml:"hour_retention" json:"hour_retention"`
+}
+
+// HTTPConfig applies to outgoing requests to Pinot, destinations and token endpoints
+type HTTPConfig struct {
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+}
+
+// DedupeConfig bounds the dedupe.duration accepted on streams
+type DedupeConfig struct {
+	MinDuration Duration `yaml:"min_duration" json:"min_duration"`
+	MaxDuration Duration `yaml:"max_duration" json:"max_duration"`
+}
+
+// SecretsConfig holds the key used to encrypt credentials at rest, inline
+// (base64) or in a file, and the directory ${file:...} references may read
+type SecretsConfig struct {
+	Key          string `yaml:"key,omitempty" json:"key,omitempty"`
+	KeyFile      string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	ReferenceDir string `yaml:"reference_dir,omitempty" json:"reference_dir,omitempty"`
+}
+
+// LoggingConfig sets the log output format, the global level (streams may
+// override it with log_level) and how many recent lines are kept per stream
+type LoggingConfig struct {
+	Format     string `yaml:"format" json:"format"`
+	Level      string `yaml:"level" json:"level"`
+	BufferSize int    `yaml:"buffer_size" json:"buffer_size"`
+}
+
+// TracingConfig selects where the traces of stream ticks are exported and
+// which fraction of ticks is traced
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" json:"exporter"`
+	Endpoint    string  `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "1m"
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.Set(node.Value)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Server:  ServerConfig{Address: ":8080", ConsoleDir: "./console"},
+		Store:   StoreConfig{Backend: storage.BackendFile, Path: "."},
+		Metrics: MetricsConfig{FlushInterval: Duration(30 * time.Second), MinuteRetention: Duration(24 * time.Hour), HourRetention: Duration(30 * 24 * time.Hour)},
+		HTTP:    HTTPConfig{Timeout: Duration(10 * time.Second)},
+		Dedupe:  DedupeConfig{MinDuration: Duration(time.Second), MaxDuration: Duration(time.Minute)},
+		Logging: LoggingConfig{Format: "text", Level: "info", BufferSize: utils.DefaultLogBufferSize},
+		Tracing: TracingConfig{Exporter: tracing.ExporterNone, SampleRatio: 1},
+	}
+}
+
+var current = struct {
+	sync.RWMutex
+	config *Config
+	path   string
+}{config: Default()}
+
+// Get returns the loaded configuration, or the defaults before Load is called
+func Get() *Config {
+	current.RLock()
+	defer current.RUnlock()
+	return current.config
+}
+
+// Path returns the configuration file that was loaded, if any
+func Path() string {
+	current.RLock()
+	defer current.RUnlock()
+	return current.path
+}
+
+// override is a setting that can be given by environment variable and flag
+type override struct {
+	env   string
+	flag  string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+var overrides = []override{
+	{"QSTREAMS_ADDRESS", "addr", "address the API listens on", func(c *Config, v string) error { c.Server.Address = v; return nil }},
+	{"QSTREAMS_CONSOLE_DIR", "console-dir", "directory served under /console/", func(c *Config, v string) error { c.Server.ConsoleDir = v; return nil }},
+	{"QSTREAMS_STORE", "store", "state store backend: file or bolt", func(c *Config, v string) error { c.Store.Backend = v; return nil }},
+	{"QSTREAMS_STORE_PATH", "store-path", "state directory (file) or database file (bolt)", func(c *Config, v string) error { c.Store.Path = v; return nil }},
+	{"QSTREAMS_METRICS_FLUSH_INTERVAL", "metrics-flush-interval", "how often metrics are persisted", func(c *Config, v string) error { return c.Metrics.FlushInterval.Set(v) }},
+	{"QSTREAMS_METRICS_MINUTE_RETENTION", "metrics-minute-retention", "how long per-minute metrics history is kept", func(c *Config, v string) error { return c.Metrics.MinuteRetention.Set(v) }},
+	{"QSTREAMS_METRICS_HOUR_RETENTION", "metrics-hour-retention", "how long hourly metrics history is kept", func(c *Config, v string) error { return c.Metrics.HourRetention.Set(v) }},
+	{"QSTREAMS_HTTP_TIMEOUT", "http-timeout", "timeout for outgoing HTTP requests", func(c *Config, v string) error { return c.HTTP.Timeout.Set(v) }},
+	{"QSTREAMS_DEDUPE_MIN_DURATION", "dedupe-min-duration", "smallest dedupe.duration accepted on streams", func(c *Config, v string) error { return c.Dedupe.MinDuration.Set(v) }},
+	{"QSTREAMS_DEDUPE_MAX_DURATION", "dedupe-max-duration", "largest dedupe.duration accepted on streams", func(c *Config, v string) error { return c.Dedupe.MaxDuration.Set(v) }},
+	{"QSTREAMS_LOG_FORMAT", "log-format", "log output format: text or json", func(c *Config, v string) error { c.Logging.Format = v; return nil }},
+	{"QSTREAMS_LOG_LEVEL", "log-level", "log level: debug, info, warn or error", func(c *Config, v string) error { c.Logging.Level = v; return nil }},
+	{"QSTREAMS_TRACING_EXPORTER", "tracing-exporter", "trace exporter: none, stdout or otlp", func(c *Config, v string) error { c.Tracing.Exporter = v; return nil }},
+	{"QSTREAMS_TRACING_ENDPOINT", "tracing-endpoint", "OTLP/HTTP collector URL, e.g. http://localhost:4318", func(c *Config, v string) error { c.Tracing.Endpoint = v; return nil }},
+	{"QSTREAMS_TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "fraction of stream ticks traced, 0 to 1", func(c *Config, v string) error {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ratio %q", v)
+		}
+		c.Tracing.SampleRatio = ratio
+		return nil
+	}},
+	{"QSTREAMS_SECRET_KEY", "", "", func(c *Config, v string) error { c.Secrets.Key = v; return nil }},
+	{"QSTREAMS_SECRET_KEY_FILE", "secret-key-file", "file holding the base64 key that encrypts credentials", func(c *Config, v string) error { c.Secrets.KeyFile = v; return nil }},
+	{"QSTREAMS_SECRET_REFERENCE_DIR", "secret-reference-dir", "directory that ${file:...} secret references and token files may read", func(c *Config, v string) error { c.Secrets.ReferenceDir = v; return nil }},
+}
+
+// Load builds the configuration from the YAML file, environment and the
+// command-line arguments args, validates it and makes it the current one.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("QSTREAMS_CONFIG"), "configuration file (default "+DefaultPath+")")
+	values := make(map[string]*string)
+	for _, o := range overrides {
+		if o.flag != "" {
+			values[o.flag] = flags.String(o.flag, "", o.usage+" (env "+o.env+")")
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	config := Default()
+	file := *path
+	if file == "" {
+		file = DefaultPath
+	}
+	loaded, err := readFile(file, config)
+	if err != nil {
+		return nil, err
+	}
+	if !loaded {
+		if *path != "" {
+			return nil, fmt.Errorf("config file %s does not exist", file)
+		}
+		file = ""
+	}
+
+	for _, o := range overrides {
+		if value := os.Getenv(o.env); value != "" {
+			if err := o.set(config, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", o.env, err)
+			}
+		}
+	}
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, o := range overrides {
+			if o.flag == f.Name && flagErr == nil {
+				if err := o.set(config, *values[o.flag]); err != nil {
+					flagErr = fmt.Errorf("-%s: %w", o.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	current.Lock()
+	defer current.Unlock()
+	current.config = config
+	current.path = file
+	return config, nil
+}
+
+// readFile decodes the YAML file at path over config, reporting whether it exists
+func readFile(path string, config *Config) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return true, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Validate checks every setting, reporting all problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.Server.Address); err != nil {
+		errs = append(errs, fmt.Errorf("server.address %q must be host:port or :port", c.Server.Address))
+	}
+	if c.Store.Backend != storage.BackendFile && c.Store.Backend != storage.BackendBolt {
+		errs = append(errs, fmt.Errorf("store.backend must be '%s' or '%s'", storage.BackendFile, storage.BackendBolt))
+	}
+	if c.Metrics.FlushInterval < Duration(time.Second) {
+		errs = append(errs, fmt.Errorf("metrics.flush_interval must be at least 1s"))
+	}
+	if c.Metrics.MinuteRetention < Duration(time.Hour) {
+		errs = append(errs, fmt.Errorf("metrics.minute_retention must be at least 1h"))
+	}
+	if c.Metrics.HourRetention < c.Metrics.MinuteRetention {
+		errs = append(errs, fmt.Errorf("metrics.hour_retention must not be less than metrics.minute_retention"))
+	}
+	if c.HTTP.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("http.timeout must be positive"))
+	}
+	if c.Dedupe.MinDuration < Duration(time.Millisecond) {
+		errs = append(errs, fmt.Errorf("dedupe.min_duration must be at least 1ms"))
+	}
+	if c.Dedupe.MaxDuration < c.Dedupe.MinDuration {
+		errs = append(errs, fmt.Errorf("dedupe.max_duration must not be less than dedupe.min_duration"))
+	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		errs = append(errs, fmt.Errorf("logging.format must be 'text' or 'json'"))
+	}
+	if _, err := utils.ParseLevel(c.Logging.Level); err != nil {
+		errs = append(errs, fmt.Errorf("logging.level: %w", err))
+	}
+	if c.Logging.BufferSize < 1 {
+		errs = append(errs, fmt.Errorf("logging.buffer_size must be at least 1"))
+	}
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be '%s', '%s' or '%s'", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP))
+	}
+	if c.Tracing.Endpoint != "" {
+		if parsed, err := url.Parse(c.Tracing.Endpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("tracing.endpoint must be an http or https URL"))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio must be between 0 and 1"))
+	}
+	if c.Secrets.Key != "" && c.Secrets.KeyFile != "" {
+		errs = append(errs, fmt.Errorf("secrets.key and secrets.key_file are mutually exclusive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy safe to show in API responses
+func (c *Config) Redacted() Config {
+	redacted := *c
+	if redacted.Secrets.Key != "" {
+		redacted.Secrets.Key = secrets.Redacted
+	}
+	return redacted
+}
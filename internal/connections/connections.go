@@ -0,0 +1,205 @@
+package connections
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"qstreams/internal/auth"
+	"qstreams/internal/httpclient"
+	"qstreams/internal/pinot"
+	"qstreams/internal/storage"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// versions counts changes to each profile so running workers can tell when
+// the profile they were built from is out of date
+var versions = struct {
+	sync.Mutex
+	Data map[string]int64
+}{
+	Data: make(map[string]int64),
+}
+
+// Version returns the change counter of a profile
+func Version(name string) int64 {
+	versions.Lock()
+	defer versions.Unlock()
+	return versions.Data[name]
+}
+
+func bump(name string) {
+	versions.Lock()
+	defer versions.Unlock()
+	versions.Data[name]++
+}
+
+// Save stores a profile and signals workers using it to reconnect
+func Save(connection *storage.Connection) error {
+	if err := storage.SaveConnection(connection); err != nil {
+		return err
+	}
+	bump(connection.Name)
+	return nil
+}
+
+// Delete removes a profile
+func Delete(name string) error {
+	if err := storage.DeleteConnection(name); err != nil {
+		return err
+	}
+	bump(name)
+	return nil
+}
+
+// Validate checks a profile before it is saved
+func Validate(connection *storage.Connection) error {
+	if !validName.MatchString(connection.Name) {
+		return fmt.Errorf("name must contain only letters, digits, '-' and '_'")
+	}
+	if connection.BrokerURL == "" && connection.ControllerURL == "" {
+		return fmt.Errorf("one of broker_url or controller_url is required")
+	}
+	if _, err := auth.NewProvider(connection.Authentication, connection.Auth, nil); err != nil {
+		return err
+	}
+	if _, err := httpclient.New(connection.TLS); err != nil {
+		return err
+	}
+	if err := pinot.ValidateOptions(connection.Options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Resolve fills in a stream's Pinot configuration from its connection profile.
+// Settings on the stream win: its broker or controller URL, auth and TLS
+// replace the profile's, its headers override headers of the same name, and
+// its query options override the profile's defaults.
+func Resolve(config storage.PinotConfig) (storage.PinotConfig, error) {
+	if config.Connection == "" {
+		return config, nil
+	}
+	connection, err := storage.LoadConnection(config.Connection)
+	if err != nil {
+		return config, fmt.Errorf("pinot.connection '%s' does not exist", config.Connection)
+	}
+
+	resolved := config
+	if resolved.BrokerURL == "" && resolved.ControllerURL == "" {
+		resolved.BrokerURL = connection.BrokerURL
+		resolved.ControllerURL = connection.ControllerURL
+	}
+	if len(connection.Authentication) > 0 {
+		headers := map[string]string{}
+		for name, value := range connection.Authentication {
+			headers[name] = value
+		}
+		for name, value := range config.Authentication {
+			headers[name] = value
+		}
+		resolved.Authentication = headers
+	}
+	if resolved.Auth == nil {
+		resolved.Auth = connection.Auth
+	}
+	if resolved.TLS == nil {
+		resolved.TLS = connection.TLS
+	}
+	resolved.Options = mergeOptions(connection.Options, config.Options)
+	return resolved, nil
+}
+
+func mergeOptions(defaults, options storage.QueryOptions) storage.QueryOptions {
+	merged := defaults
+	if options.TimeoutMs > 0 {
+		merged.TimeoutMs = options.TimeoutMs
+	}
+	if options.MaxExecutionThreads > 0 {
+		merged.MaxExecutionThreads = options.MaxExecutionThreads
+	}
+	if options.UseMultistageEngine != nil {
+		merged.UseMultistageEngine = options.UseMultistageEngine
+	}
+	if options.EnableNullHandling != nil {
+		merged.EnableNullHandling = options.EnableNullHandling
+	}
+	if options.Trace != nil {
+		merged.Trace = options.Trace
+	}
+
+	if len(defaults.QueryOptions) > 0 || len(options.QueryOptions) > 0 {
+		merged.QueryOptions = map[string]string{}
+		for key, value := range defaults.QueryOptions {
+			merged.QueryOptions[key] = value
+		}
+		for key, value := range options.QueryOptions {
+			merged.QueryOptions[key] = value
+		}
+	}
+	return merged
+}
+
+// Check is the outcome of reaching one Pinot component
+type Check struct {
+	URL       string `json:"url"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TestResult reports whether a profile's broker or controller is reachable
+type TestResult struct {
+	OK         bool     `json:"ok"`
+	Broker     *Check   `json:"broker,omitempty"`
+	Controller *Check   `json:"controller,omitempty"`
+	Brokers    []string `json:"brokers,omitempty"`
+}
+
+// Test checks the health endpoints of a profile's broker and controller with
+// its auth and TLS settings. When table is given, brokers for it are also
+// discovered from the controller.
+func Test(ctx context.Context, connection *storage.Connection, table string) (*TestResult, error) {
+	httpClient, err := httpclient.New(connection.TLS)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := auth.NewProvider(connection.Authentication, connection.Auth, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TestResult{OK: true}
+	check := func(target string) *Check {
+		start := time.Now()
+		err := pinot.NewClient(target, httpClient, provider).Health(ctx)
+		c := &Check{URL: target, OK: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			c.Error = err.Error()
+			result.OK = false
+		}
+		return c
+	}
+
+	if connection.BrokerURL != "" {
+		result.Broker = check(connection.BrokerURL)
+	}
+	if connection.ControllerURL != "" {
+		result.Controller = check(connection.ControllerURL)
+		if table != "" && result.Controller.OK {
+			pool := pinot.NewBrokerPool(connection.ControllerURL, table, 0, httpClient, provider)
+			if err := pool.Refresh(ctx); err != nil {
+				result.Controller.OK = false
+				result.Controller.Error = err.Error()
+				result.OK = false
+			}
+			for _, broker := range pool.Brokers() {
+				result.Brokers = append(result.Brokers, broker.URL)
+			}
+		}
+	}
+	return result, nil
+}
@@ -1,13 +1,14 @@
 package core
 
 import (
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"qstreams/internal/metrics"
 	"qstreams/internal/models"
 	"qstreams/internal/storage"
+	"qstreams/shared/utils"
 )
 
 var MetricsCache = struct {
@@ -27,7 +28,7 @@ func LoadMetrics() error {
 	MetricsCache.Lock()
 	defer MetricsCache.Unlock()
 	MetricsCache.Data = metrics
-	log.Printf("Loaded metrics for %d stream(s) from state store.", len(metrics))
+	slog.Info("Loaded metrics from state store", "streams", len(metrics))
 	return nil
 }
 
@@ -45,9 +46,9 @@ func SaveMetricsFlush(interval time.Duration) {
 		MetricsCache.Unlock()
 
 		if err := storage.SaveAllMetrics(data); err != nil {
-			log.Printf("Failed to flush metrics to disk: %v", err)
+			slog.Error("Failed to flush metrics", "error", err)
 		} else {
-			log.Println("Metrics successfully flushed to disk.")
+			slog.Debug("Metrics flushed")
 		}
 	}
 }
@@ -59,6 +60,6 @@ func DeleteMetricsForStream(streamID string) {
 	delete(metrics.Cache.Data, streamID)
 	err := metrics.DeleteMetricsFile(streamID)
 	if err != nil {
-		log.Printf("Failed to delete metrics file for stream '%s': %v", streamID, err)
+		slog.Error("Failed to delete metrics", utils.FieldStreamID, streamID, "error", err)
 	}
-}
\ No newline at end of file
+}
@@ -2,26 +2,28 @@ package core
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"qstreams/internal/destinations"
-	"qstreams/internal/destinations/webhook"
+	_ "qstreams/internal/destinations/all"
 	"qstreams/internal/storage"
 	"qstreams/internal/worker"
+	"qstreams/shared/signature"
+	"qstreams/shared/utils"
 
 	"github.com/google/uuid"
 )
 
-func NewDestination(config storage.DestinationConfig) (destinations.Destination, error) {
-	switch config.Type {
-	case "webhook":
-		dest := webhook.NewWebhook(config.URL)
-		if err := dest.Validate(); err != nil {
-			return nil, fmt.Errorf("invalid webhook configuration: %w", err)
-		}
-		return dest, nil
-	default:
-		return nil, fmt.Errorf("unsupported destination type: %s", config.Type)
+// EnsureSigningSecret generates a secret for an enabled signing config that has none
+func EnsureSigningSecret(signing *storage.SigningConfig) error {
+	if !signing.Enabled || len(signing.Secrets) > 0 {
+		return nil
+	}
+	secret, err := signature.NewSecret()
+	if err != nil {
+		return fmt.Errorf("failed to generate signing secret: %w", err)
 	}
+	signing.Secrets = []string{secret}
+	return nil
 }
 
 // CreateStream initializes and saves a new stream with a unique UUID
@@ -29,8 +31,13 @@ func CreateStream(stream *storage.QueryStream) error {
 	// Generate a unique StreamID for the stream
 	stream.StreamID = uuid.New().String()
 
+	// Generate a signing secret when signing is enabled without one
+	if err := EnsureSigningSecret(&stream.Destination.Signing); err != nil {
+		return err
+	}
+
 	// Log the creation of the stream
-	log.Printf("Stream '%s' created with ID: %s", stream.Name, stream.StreamID)
+	utils.StreamLogger(stream.StreamID, stream.Name).Info("Stream created")
 
 	// Save the stream to the state store
 	if err := storage.SaveStream(stream); err != nil {
@@ -38,7 +45,7 @@ func CreateStream(stream *storage.QueryStream) error {
 	}
 
 	// Create and validate the destination
-	dest, err := NewDestination(stream.Destination)
+	dest, err := destinations.New(stream.Destination)
 	if err != nil {
 		return fmt.Errorf("failed to create destination for stream '%s': %w", stream.StreamID, err)
 	}
@@ -56,18 +63,19 @@ func RestoreStreams() error {
 		return fmt.Errorf("failed to list streams from the state store: %w", err)
 	}
 
-	log.Printf("Found %d stream(s) in the state store. Beginning restoration process...", len(streams))
+	slog.Info("Beginning stream restoration", "streams", len(streams))
 
 	for _, stream := range streams {
+		logger := utils.StreamLogger(stream.StreamID, stream.Name)
 		switch stream.State {
 		case "submitted", "creating", "running":
-			log.Printf("Initializing stream '%s' (state: %s). Transitioning to 'running' state...", stream.StreamID, stream.State)
+			logger.Info("Initializing stream, transitioning to 'running'", "state", stream.State)
 			stream.State = "running" // Move to running state
 
 			// Create and validate destination
-			dest, err := NewDestination(stream.Destination)
+			dest, err := destinations.New(stream.Destination)
 			if err != nil {
-				log.Printf("Failed to initialize stream '%s'. Error: %v", stream.StreamID, err)
+				logger.Error("Failed to initialize stream", utils.FieldDestination, stream.Destination.Type, "error", err)
 				continue
 			}
 
@@ -75,27 +83,27 @@ func RestoreStreams() error {
 			go worker.RunStreamWorker(&stream, dest)
 
 		case "stopped":
-			log.Printf("Skipping stream '%s'. Current state: 'stopped'. Stream will remain inactive.", stream.StreamID)
+			logger.Info("Skipping stopped stream, it will remain inactive")
 
 		default:
-			log.Printf("Unknown state for stream '%s'. Current state: '%s'. Skipping.", stream.StreamID, stream.State)
+			logger.Warn("Skipping stream in unknown state", "state", stream.State)
 		}
 	}
 
-	log.Println("Stream restoration process completed.")
+	slog.Info("Stream restoration completed")
 	return nil
 }
 
 // RestartStreamWorker restarts a worker for a stream
 func RestartStreamWorker(stream *storage.QueryStream) {
 	// Create and validate the destination
-	dest, err := NewDestination(stream.Destination)
+	dest, err := destinations.New(stream.Destination)
 	if err != nil {
-		log.Printf("Failed to restart stream '%s': invalid destination configuration. Error: %v", stream.StreamID, err)
+		utils.StreamLogger(stream.StreamID, stream.Name).Error("Failed to restart stream: invalid destination configuration", utils.FieldDestination, stream.Destination.Type, "error", err)
 		return
 	}
 
 	// Start the worker
 	go worker.RunStreamWorker(stream, dest)
-	log.Printf("Stream '%s' worker restarted.", stream.StreamID)
-}
\ No newline at end of file
+	utils.StreamLogger(stream.StreamID, stream.Name).Info("Stream worker restarted")
+}
@@ -0,0 +1,7 @@
+// Package all registers every built-in destination type. Import it for its
+// side effects; new destination packages only need to be added here.
+package all
+
+import (
+	_ "qstreams/internal/destinations/webhook"
+)
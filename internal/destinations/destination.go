@@ -1,7 +1,59 @@
 package destinations
 
+import (
+	"context"
+	"time"
+)
+
+// Delivery is a single payload produced by a stream tick
+type Delivery struct {
+	StreamID    string
+	StreamName  string
+	Payload     []byte
+	ContentType string
+	// ContentEncoding names the compression algorithm applied to Payload,
+	// empty when the payload is not compressed
+	ContentEncoding string
+	// Headers carries delivery metadata. HTTP destinations send these as
+	// request headers; other destinations map them to their own attributes.
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// Capabilities describes optional behaviour a destination supports
+type Capabilities struct {
+	// Batching is set when a destination can accept several deliveries in one call
+	Batching bool `json:"batching"`
+	// Ordering is set when deliveries are applied in the order they are sent
+	Ordering bool `json:"ordering"`
+	// Compression lists the compression algorithms the destination's
+	// protocol can carry
+	Compression []string `json:"compression"`
+	// Protocol selects the CloudEvents binding used in binary mode: http,
+	// kafka or amqp
+	Protocol string `json:"protocol"`
+}
+
+// EncodingNegotiator is implemented by destinations that learn at runtime
+// whether the receiver accepts a compression algorithm
+type EncodingNegotiator interface {
+	AcceptsEncoding(algorithm string) bool
+}
+
+// SupportsCompression reports whether a destination type can carry algorithm
+func SupportsCompression(destinationType, algorithm string) bool {
+	for _, supported := range Types()[destinationType].Capabilities.Compression {
+		if supported == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
 type Destination interface {
-	Send(data []byte) error
+	Send(ctx context.Context, delivery Delivery) error
 	Validate() error
-	GetURL() string 
-}
\ No newline at end of file
+	HealthCheck(ctx context.Context) error
+	Capabilities() Capabilities
+	Close() error
+}
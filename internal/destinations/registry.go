@@ -0,0 +1,157 @@
+package destinations
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"qstreams/internal/storage"
+)
+
+// Factory builds a destination from its stream configuration. Factories must
+// not perform network I/O; connections are established lazily on Send so a
+// factory can also be used to validate a configuration.
+type Factory func(config storage.DestinationConfig) (Destination, error)
+
+// Field describes one entry of a destination's options map
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // string, number, bool, object or list
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// Schema documents a destination type and the options it accepts
+type Schema struct {
+	Description  string       `json:"description"`
+	Options      []Field      `json:"options"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+type registration struct {
+	factory Factory
+	schema  Schema
+}
+
+var registry = struct {
+	sync.RWMutex
+	types map[string]registration
+}{types: make(map[string]registration)}
+
+// Register makes a destination type available under name. It is meant to be
+// called from the init function of the destination's package and panics if
+// the name is registered twice.
+func Register(name string, factory Factory, schema Schema) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, exists := registry.types[name]; exists {
+		panic(fmt.Sprintf("destinations: type %q registered twice", name))
+	}
+	registry.types[name] = registration{factory: factory, schema: schema}
+}
+
+// New creates and validates a destination for the given configuration
+func New(config storage.DestinationConfig) (Destination, error) {
+	registry.RLock()
+	reg, exists := registry.types[config.Type]
+	registry.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unsupported destination type: %s", config.Type)
+	}
+	if err := validateOptions(reg.schema, config.Options); err != nil {
+		return nil, fmt.Errorf("invalid %s configuration: %w", config.Type, err)
+	}
+
+	dest, err := reg.factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s configuration: %w", config.Type, err)
+	}
+	if err := dest.Validate(); err != nil {
+		dest.Close()
+		return nil, fmt.Errorf("invalid %s configuration: %w", config.Type, err)
+	}
+	return dest, nil
+}
+
+// Validate checks a configuration by building and immediately closing a destination
+func Validate(config storage.DestinationConfig) error {
+	dest, err := New(config)
+	if err != nil {
+		return err
+	}
+	return dest.Close()
+}
+
+// Types returns the schema of every registered destination type keyed by name
+func Types() map[string]Schema {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	types := make(map[string]Schema, len(registry.types))
+	for name, reg := range registry.types {
+		types[name] = reg.schema
+	}
+	return types
+}
+
+// Names returns the registered destination type names in sorted order
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.types))
+	for name := range registry.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateOptions(schema Schema, options map[string]interface{}) error {
+	known := make(map[string]Field, len(schema.Options))
+	for _, field := range schema.Options {
+		known[field.Name] = field
+		if _, set := options[field.Name]; field.Required && !set {
+			return fmt.Errorf("options.%s is required", field.Name)
+		}
+	}
+
+	for name, value := range options {
+		field, exists := known[name]
+		if !exists {
+			return fmt.Errorf("options.%s is not a recognized option", name)
+		}
+		if !matchesType(field.Type, value) {
+			return fmt.Errorf("options.%s must be of type %s", name, field.Type)
+		}
+	}
+	return nil
+}
+
+// matchesType checks a JSON-decoded value against a schema field type
+func matchesType(fieldType string, value interface{}) bool {
+	switch fieldType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		switch value.(type) {
+		case float64, int, int64:
+			return true
+		}
+		return false
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "list":
+		_, ok := value.([]interface{})
+		return ok
+	default:
+		return true
+	}
+}
@@ -2,38 +2,264 @@ package webhook
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"qstreams/internal/auth"
+	"qstreams/internal/compress"
+	"qstreams/internal/destinations"
+	"qstreams/internal/httpclient"
+	"qstreams/internal/metrics"
+	"qstreams/internal/secrets"
+	"qstreams/internal/storage"
+	"qstreams/internal/tracing"
+	"qstreams/shared/signature"
+	"qstreams/shared/utils"
 )
 
+var capabilities = destinations.Capabilities{
+	Batching: false,
+	Ordering: true,
+	// Snappy has no registered HTTP content coding
+	Compression: []string{compress.Gzip, compress.Zstd},
+	Protocol:    "http",
+}
+
+func init() {
+	destinations.Register("webhook", New, destinations.Schema{
+		Description: "POSTs each delivery to an HTTP endpoint",
+		Options: []destinations.Field{
+			{Name: "method", Type: "string", Description: "HTTP method used for deliveries (default POST)"},
+			{Name: "headers", Type: "object", Description: "Additional static headers sent with every delivery"},
+		},
+		Capabilities: capabilities,
+	})
+}
+
 type Webhook struct {
-	URL string
+	URL     string
+	Method  string
+	Headers map[string]string
+	Signing storage.SigningConfig
+
+	auth   auth.Provider
+	client *http.Client
+
+	// rejected records encodings the receiver answered with 415
+	rejected sync.Map
 }
 
-func NewWebhook(url string) *Webhook {
-	return &Webhook{URL: url}
+// New builds a webhook destination from a stream's destination configuration
+func New(config storage.DestinationConfig) (destinations.Destination, error) {
+	client, err := httpclient.New(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := auth.NewProvider(config.Authentication, config.Auth, client)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{
+		URL:     config.URL,
+		Method:  http.MethodPost,
+		Headers: map[string]string{},
+		Signing: config.Signing,
+		auth:    provider,
+		client:  client,
+	}
+	if method, ok := config.Options["method"].(string); ok && method != "" {
+		w.Method = method
+	}
+	if headers, ok := config.Options["headers"].(map[string]interface{}); ok {
+		for key, value := range headers {
+			w.Headers[key] = fmt.Sprint(value)
+		}
+	}
+	return w, nil
 }
 
-func (w *Webhook) Send(data []byte) error {
-	resp, err := http.Post(w.URL, "application/json", bytes.NewBuffer(data))
+func (w *Webhook) Send(ctx context.Context, delivery destinations.Delivery) error {
+	resp, err := w.send(ctx, delivery)
 	if err != nil {
-		return fmt.Errorf("failed to send data to webhook: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	// The receiver does not accept the compressed body (RFC 7694). Remember
+	// that, and retry once with the uncompressed payload.
+	if resp.StatusCode == http.StatusUnsupportedMediaType && delivery.ContentEncoding != "" {
+		if !acceptsEncoding(resp.Header.Values("Accept-Encoding"), compress.ContentEncoding(delivery.ContentEncoding)) {
+			w.rejected.Store(delivery.ContentEncoding, true)
+		}
+		payload, err := compress.Decompress(delivery.ContentEncoding, delivery.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to decompress payload for retry: %w", err)
+		}
+		utils.StreamLogger(delivery.StreamID, delivery.StreamName).Warn("Receiver rejected compressed payload, retrying uncompressed",
+			utils.FieldDestination, "webhook", utils.FieldAttempt, 2, "content_encoding", delivery.ContentEncoding)
+		metrics.RecordRetry(delivery.StreamID)
+		delivery.Payload = payload
+		delivery.ContentEncoding = ""
+
+		retry, err := w.send(ctx, delivery)
+		if err != nil {
+			return err
+		}
+		defer retry.Body.Close()
+		resp = retry
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		return fmt.Errorf("webhook responded with status: %d", resp.StatusCode)
 	}
 	return nil
 }
 
+// AcceptsEncoding reports whether the receiver has not rejected algorithm
+func (w *Webhook) AcceptsEncoding(algorithm string) bool {
+	_, rejected := w.rejected.Load(algorithm)
+	return !rejected
+}
+
+func (w *Webhook) send(ctx context.Context, delivery destinations.Delivery) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, w.Method, w.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	contentType := delivery.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	if delivery.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", compress.ContentEncoding(delivery.ContentEncoding))
+	}
+	for key, value := range w.Headers {
+		resolved, err := secrets.Resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve webhook header %s: %w", key, err)
+		}
+		req.Header.Set(key, resolved)
+	}
+	for key, value := range delivery.Headers {
+		req.Header.Set(key, value)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	// Add authentication for the destination
+	if err := w.auth.Apply(req); err != nil {
+		return nil, fmt.Errorf("failed to authenticate webhook request: %w", err)
+	}
+
+	// Sign the payload with every active secret
+	if w.Signing.Enabled {
+		header := w.Signing.Header
+		if header == "" {
+			header = signature.HeaderName
+		}
+		timestamp := delivery.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+		keys := make([]string, len(w.Signing.Secrets))
+		for i, secret := range w.Signing.Secrets {
+			resolved, err := secrets.Resolve(secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve signing secret: %w", err)
+			}
+			keys[i] = resolved
+		}
+		// Each request gets its own id, which receivers use to detect replays
+		id, err := signature.NewDeliveryID()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(signature.IDHeaderName, id)
+		req.Header.Set(header, signature.Header(delivery.Payload, keys, id, timestamp))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send data to webhook: %w", err)
+	}
+	auth.Rejected(w.auth, resp)
+	return resp, nil
+}
+
+// acceptsEncoding checks the Accept-Encoding values of a 415 response
+func acceptsEncoding(values []string, encoding string) bool {
+	for _, value := range values {
+		for _, token := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(token), ";")
+			if strings.EqualFold(name, encoding) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (w *Webhook) Validate() error {
 	if w.URL == "" {
 		return fmt.Errorf("webhook URL cannot be empty")
 	}
+	parsed, err := url.Parse(w.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook URL must be an absolute http(s) URL")
+	}
+	for key, value := range w.Headers {
+		if err := secrets.CheckReferences(value); err != nil {
+			return fmt.Errorf("webhook header %s: %w", key, err)
+		}
+	}
+	for _, secret := range w.Signing.Secrets {
+		if err := secrets.CheckReferences(secret); err != nil {
+			return fmt.Errorf("signing secret: %w", err)
+		}
+	}
+	return nil
+}
+
+// HealthCheck reports whether the webhook host is reachable. Any response
+// below 500 counts as healthy since many webhooks reject HEAD requests.
+func (w *Webhook) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, w.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	if err := w.auth.Apply(req); err != nil {
+		return fmt.Errorf("failed to authenticate health check: %w", err)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	auth.Rejected(w.auth, resp)
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook responded with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *Webhook) Capabilities() destinations.Capabilities {
+	return capabilities
+}
+
+func (w *Webhook) Close() error {
+	w.client.CloseIdleConnections()
 	return nil
 }
 
 func (w *Webhook) GetURL() string {
 	return w.URL
-}
\ No newline at end of file
+}
@@ -0,0 +1,166 @@
+package format
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// arrowEncoder emits an Arrow IPC stream holding the schema and a single
+// record batch with every row of the delivery.
+type arrowEncoder struct{}
+
+func (arrowEncoder) ContentType() string { return "application/vnd.apache.arrow.stream" }
+
+func (arrowEncoder) Encode(result *Result) ([]byte, error) {
+	columns := result.Columns()
+	types := result.ColumnTypes()
+	schema := ArrowSchema(columns, types)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+
+	for _, row := range result.Rows() {
+		for i := range columns {
+			var value interface{}
+			if i < len(row) {
+				value = row[i]
+			}
+			if err := appendArrowValue(builder.Field(i), value); err != nil {
+				return nil, fmt.Errorf("column %s: %w", columns[i], err)
+			}
+		}
+	}
+
+	record := builder.NewRecord()
+	defer record.Release()
+
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator))
+	if err := writer.Write(record); err != nil {
+		return nil, fmt.Errorf("failed to write arrow record batch: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close arrow stream: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ArrowSchema derives an Arrow schema from Pinot column names and types.
+// Every field is nullable and carries the Pinot type as field metadata.
+func ArrowSchema(columns, types []string) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+	for i, column := range columns {
+		dataType := ""
+		if i < len(types) {
+			dataType = types[i]
+		}
+		fields[i] = arrow.Field{
+			Name:     column,
+			Type:     arrowType(dataType),
+			Nullable: true,
+			Metadata: arrow.NewMetadata([]string{"pinot.type"}, []string{dataType}),
+		}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func arrowType(dataType string) arrow.DataType {
+	if strings.HasSuffix(dataType, "_ARRAY") {
+		return arrow.ListOf(arrowType(strings.TrimSuffix(dataType, "_ARRAY")))
+	}
+	switch dataType {
+	case "INT":
+		return arrow.PrimitiveTypes.Int32
+	case "LONG":
+		return arrow.PrimitiveTypes.Int64
+	case "FLOAT":
+		return arrow.PrimitiveTypes.Float32
+	case "DOUBLE":
+		return arrow.PrimitiveTypes.Float64
+	case "BOOLEAN":
+		return arrow.FixedWidthTypes.Boolean
+	case "TIMESTAMP":
+		return arrow.FixedWidthTypes.Timestamp_ms
+	case "BYTES":
+		return arrow.BinaryTypes.Binary
+	default:
+		// STRING, JSON, BIG_DECIMAL and unknown types
+		return arrow.BinaryTypes.String
+	}
+}
+
+func appendArrowValue(builder array.Builder, value interface{}) error {
+	if value == nil {
+		builder.AppendNull()
+		return nil
+	}
+
+	switch b := builder.(type) {
+	case *array.Int32Builder:
+		i, ok := toInt64(value)
+		if !ok {
+			return fmt.Errorf("cannot encode %v as INT", value)
+		}
+		b.Append(int32(i))
+	case *array.Int64Builder:
+		i, ok := toInt64(value)
+		if !ok {
+			return fmt.Errorf("cannot encode %v as LONG", value)
+		}
+		b.Append(i)
+	case *array.Float32Builder:
+		f, ok := toFloat64(value)
+		if !ok {
+			return fmt.Errorf("cannot encode %v as FLOAT", value)
+		}
+		b.Append(float32(f))
+	case *array.Float64Builder:
+		f, ok := toFloat64(value)
+		if !ok {
+			return fmt.Errorf("cannot encode %v as DOUBLE", value)
+		}
+		b.Append(f)
+	case *array.BooleanBuilder:
+		v, ok := toBool(value)
+		if !ok {
+			return fmt.Errorf("cannot encode %v as BOOLEAN", value)
+		}
+		b.Append(v)
+	case *array.TimestampBuilder:
+		i, ok := toTimestampMillis(value)
+		if !ok {
+			return fmt.Errorf("cannot encode %v as TIMESTAMP", value)
+		}
+		b.Append(arrow.Timestamp(i))
+	case *array.BinaryBuilder:
+		// Pinot returns BYTES columns as hex strings
+		data, err := hex.DecodeString(toString(value))
+		if err != nil {
+			return fmt.Errorf("BYTES value is not hex encoded: %w", err)
+		}
+		b.Append(data)
+	case *array.StringBuilder:
+		b.Append(toString(value))
+	case *array.ListBuilder:
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected an array, got %T", value)
+		}
+		b.Append(true)
+		for _, item := range items {
+			if err := appendArrowValue(b.ValueBuilder(), item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported arrow builder %T", builder)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package format
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// avroEncoder emits an Avro object container file holding one record per row.
+// The record schema is derived from the result's dataSchema; every field is
+// nullable since Pinot may return nulls when null handling is enabled.
+type avroEncoder struct{}
+
+func (avroEncoder) ContentType() string { return "application/avro" }
+
+func (avroEncoder) Encode(result *Result) ([]byte, error) {
+	columns := result.Columns()
+	types := result.ColumnTypes()
+
+	schema, err := AvroSchema(columns, types)
+	if err != nil {
+		return nil, err
+	}
+
+	var block []byte
+	for _, row := range result.Rows() {
+		for i := range columns {
+			var value interface{}
+			if i < len(row) {
+				value = row[i]
+			}
+			dataType := ""
+			if i < len(types) {
+				dataType = types[i]
+			}
+			if block, err = appendAvroNullable(block, value, dataType); err != nil {
+				return nil, fmt.Errorf("column %s: %w", columns[i], err)
+			}
+		}
+	}
+
+	sync := make([]byte, 16)
+	if _, err := rand.Read(sync); err != nil {
+		return nil, fmt.Errorf("failed to generate avro sync marker: %w", err)
+	}
+
+	// Header: magic, file metadata and sync marker
+	buf := []byte{'O', 'b', 'j', 1}
+	buf = appendAvroLong(buf, 2)
+	buf = appendAvroString(buf, "avro.schema")
+	buf = appendAvroBytes(buf, schema)
+	buf = appendAvroString(buf, "avro.codec")
+	buf = appendAvroBytes(buf, []byte("null"))
+	buf = appendAvroLong(buf, 0)
+	buf = append(buf, sync...)
+
+	// A single data block with every row
+	if rows := len(result.Rows()); rows > 0 {
+		buf = appendAvroLong(buf, int64(rows))
+		buf = appendAvroLong(buf, int64(len(block)))
+		buf = append(buf, block...)
+		buf = append(buf, sync...)
+	}
+	return buf, nil
+}
+
+var avroInvalidName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// AvroSchema derives an Avro record schema from Pinot column names and types
+func AvroSchema(columns, types []string) ([]byte, error) {
+	names := avroNames(columns)
+	fields := make([]map[string]interface{}, 0, len(columns))
+	for i, column := range columns {
+		dataType := ""
+		if i < len(types) {
+			dataType = types[i]
+		}
+		field := map[string]interface{}{
+			"name":    names[i],
+			"type":    []interface{}{"null", avroType(dataType)},
+			"default": nil,
+		}
+		if field["name"] != column {
+			field["doc"] = column
+		}
+		fields = append(fields, field)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"type":      "record",
+		"name":      "Row",
+		"namespace": "qstreams",
+		"fields":    fields,
+	})
+}
+
+// avroNames gives each column a distinct, valid Avro field name. Valid names
+// are kept; a column whose name clashes once made valid, such as "a-b" next
+// to "a_b", gets a numeric suffix: a_b_2.
+func avroNames(columns []string) []string {
+	names := make([]string, len(columns))
+	used := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		if avroName(column) == column && !used[column] {
+			names[i] = column
+			used[column] = true
+		}
+	}
+	for i, column := range columns {
+		if names[i] != "" {
+			continue
+		}
+		name := avroName(column)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", avroName(column), n)
+		}
+		names[i] = name
+		used[name] = true
+	}
+	return names
+}
+
+// avroName turns a column name into a valid Avro field name
+func avroName(column string) string {
+	name := avroInvalidName.ReplaceAllString(column, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func avroType(dataType string) interface{} {
+	if strings.HasSuffix(dataType, "_ARRAY") {
+		return map[string]interface{}{
+			"type":  "array",
+			"items": avroType(strings.TrimSuffix(dataType, "_ARRAY")),
+		}
+	}
+	switch dataType {
+	case "INT":
+		return "int"
+	case "LONG":
+		return "long"
+	case "TIMESTAMP":
+		return map[string]interface{}{"type": "long", "logicalType": "timestamp-millis"}
+	case "FLOAT":
+		return "float"
+	case "DOUBLE":
+		return "double"
+	case "BOOLEAN":
+		return "boolean"
+	case "BYTES":
+		return "bytes"
+	default:
+		// STRING, JSON, BIG_DECIMAL and unknown types
+		return "string"
+	}
+}
+
+// appendAvroNullable encodes a value of the ["null", T] union
+func appendAvroNullable(buf []byte, value interface{}, dataType string) ([]byte, error) {
+	if value == nil {
+		return appendAvroLong(buf, 0), nil
+	}
+	buf = appendAvroLong(buf, 1)
+	return appendAvroValue(buf, value, dataType)
+}
+
+func appendAvroValue(buf []byte, value interface{}, dataType string) ([]byte, error) {
+	if strings.HasSuffix(dataType, "_ARRAY") {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %s", dataType)
+		}
+		itemType := strings.TrimSuffix(dataType, "_ARRAY")
+		if len(items) > 0 {
+			buf = appendAvroLong(buf, int64(len(items)))
+			for _, item := range items {
+				var err error
+				if buf, err = appendAvroValue(buf, item, itemType); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return appendAvroLong(buf, 0), nil
+	}
+
+	switch dataType {
+	case "INT", "LONG":
+		i, ok := toInt64(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as %s", value, dataType)
+		}
+		return appendAvroLong(buf, i), nil
+	case "TIMESTAMP":
+		i, ok := toTimestampMillis(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as TIMESTAMP", value)
+		}
+		return appendAvroLong(buf, i), nil
+	case "FLOAT":
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as FLOAT", value)
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+	case "DOUBLE":
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as DOUBLE", value)
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case "BOOLEAN":
+		b, ok := toBool(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as BOOLEAN", value)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case "BYTES":
+		data, err := hex.DecodeString(toString(value))
+		if err != nil {
+			return nil, fmt.Errorf("BYTES value is not hex encoded: %w", err)
+		}
+		return appendAvroBytes(buf, data), nil
+	default:
+		return appendAvroString(buf, toString(value)), nil
+	}
+}
+
+// appendAvroLong writes a zig-zag encoded variable length integer
+func appendAvroLong(buf []byte, i int64) []byte {
+	return binary.AppendUvarint(buf, uint64((i<<1)^(i>>63)))
+}
+
+func appendAvroBytes(buf []byte, data []byte) []byte {
+	buf = appendAvroLong(buf, int64(len(data)))
+	return append(buf, data...)
+}
+
+func appendAvroString(buf []byte, s string) []byte {
+	buf = appendAvroLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
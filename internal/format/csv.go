@@ -0,0 +1,40 @@
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+// csvEncoder emits a header line with the column names followed by one line per row
+type csvEncoder struct{}
+
+func (csvEncoder) ContentType() string { return "text/csv" }
+
+func (csvEncoder) Encode(result *Result) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	columns := result.Columns()
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range result.Rows() {
+		for i := range record {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = toString(row[i])
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,214 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"qstreams/internal/pinot"
+)
+
+// DefaultFormat delivers the Pinot broker response as returned by the broker
+const DefaultFormat = "pinot"
+
+// Result is the data handed to an encoder for a single delivery
+type Result struct {
+	StreamID   string
+	StreamName string
+	// Response is the broker response with the result table restricted to
+	// the rows of this delivery
+	Response *pinot.BrokerResponse
+	// Chunk is set when the result is split into several deliveries
+	Chunk *ChunkInfo
+	// Previous is the last result delivered by the stream, if any
+	Previous *pinot.BrokerResponse
+}
+
+// ChunkInfo describes a chunk's position within a chunked result
+type ChunkInfo struct {
+	Index int `json:"index"`
+	Total int `json:"total"`
+}
+
+func (r *Result) Columns() []string {
+	if r.Response == nil || r.Response.ResultTable == nil {
+		return nil
+	}
+	return r.Response.ResultTable.DataSchema.ColumnNames
+}
+
+func (r *Result) ColumnTypes() []string {
+	if r.Response == nil || r.Response.ResultTable == nil {
+		return nil
+	}
+	return r.Response.ResultTable.DataSchema.ColumnDataTypes
+}
+
+func (r *Result) Rows() [][]interface{} {
+	if r.Response == nil {
+		return nil
+	}
+	return r.Response.Rows()
+}
+
+// Encoder turns a result into a delivery payload
+type Encoder interface {
+	ContentType() string
+	Encode(result *Result) ([]byte, error)
+}
+
+var encoders = map[string]Encoder{
+	"pinot":         pinotEncoder{},
+	"json":          jsonRowsEncoder{},
+	"json_columnar": jsonColumnarEncoder{},
+	"ndjson":        ndjsonEncoder{},
+	"csv":           csvEncoder{},
+	"msgpack":       msgpackEncoder{},
+	"protobuf":      protobufEncoder{},
+	"avro":          avroEncoder{},
+	"arrow":         arrowEncoder{},
+}
+
+// Get returns the encoder registered under name, or the default encoder for
+// an empty name.
+func Get(name string) (Encoder, error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+	encoder, exists := encoders[name]
+	if !exists {
+		return nil, fmt.Errorf("unsupported format: %s", name)
+	}
+	return encoder, nil
+}
+
+// Names returns the supported format names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rowObject maps a row's values to its column names
+func rowObject(columns []string, row []interface{}) map[string]interface{} {
+	object := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if i < len(row) {
+			object[column] = row[i]
+		}
+	}
+	return object
+}
+
+// The helpers below normalize values decoded from the broker response, where
+// numbers arrive as json.Number.
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return int64(f), true
+		}
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, true
+		}
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// timestampLayouts are the string forms of a TIMESTAMP column: Pinot's own
+// "2024-01-01 00:00:00.0", with or without fractional seconds, and RFC 3339
+var timestampLayouts = []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano}
+
+// toTimestampMillis converts a TIMESTAMP value, given as epoch milliseconds or
+// as a string Pinot renders in UTC, to epoch milliseconds
+func toTimestampMillis(value interface{}) (int64, bool) {
+	if i, ok := toInt64(value); ok {
+		return i, true
+	}
+	s, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UnixMilli(), true
+		}
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+func toBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	case json.Number:
+		i, err := v.Int64()
+		return i != 0, err == nil
+	}
+	return false, false
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
@@ -0,0 +1,69 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"qstreams/internal/pinot"
+)
+
+// pinotEncoder emits the broker response as JSON, with chunk metadata when chunked
+type pinotEncoder struct{}
+
+func (pinotEncoder) ContentType() string { return "application/json" }
+
+func (pinotEncoder) Encode(result *Result) ([]byte, error) {
+	return json.Marshal(struct {
+		*pinot.BrokerResponse
+		Chunk *ChunkInfo `json:"chunk,omitempty"`
+	}{result.Response, result.Chunk})
+}
+
+// jsonRowsEncoder emits an array with one object per row
+type jsonRowsEncoder struct{}
+
+func (jsonRowsEncoder) ContentType() string { return "application/json" }
+
+func (jsonRowsEncoder) Encode(result *Result) ([]byte, error) {
+	columns := result.Columns()
+	return json.Marshal(rowObjects(columns, result.Rows()))
+}
+
+// jsonColumnarEncoder emits an object mapping each column to its values
+type jsonColumnarEncoder struct{}
+
+func (jsonColumnarEncoder) ContentType() string { return "application/json" }
+
+func (jsonColumnarEncoder) Encode(result *Result) ([]byte, error) {
+	columns := result.Columns()
+	data := make(map[string][]interface{}, len(columns))
+	for i, column := range columns {
+		values := make([]interface{}, 0, len(result.Rows()))
+		for _, row := range result.Rows() {
+			if i < len(row) {
+				values = append(values, row[i])
+			} else {
+				values = append(values, nil)
+			}
+		}
+		data[column] = values
+	}
+	return json.Marshal(data)
+}
+
+// ndjsonEncoder emits one JSON object per line
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) ContentType() string { return "application/x-ndjson" }
+
+func (ndjsonEncoder) Encode(result *Result) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	columns := result.Columns()
+	for _, row := range result.Rows() {
+		if err := encoder.Encode(rowObject(columns, row)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
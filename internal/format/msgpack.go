@@ -0,0 +1,155 @@
+package format
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// msgpackEncoder emits a MessagePack array with one map per row. Map keys
+// follow the column order of the result.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string { return "application/msgpack" }
+
+func (msgpackEncoder) Encode(result *Result) ([]byte, error) {
+	columns := result.Columns()
+	rows := result.Rows()
+
+	buf := appendMsgpackArrayHeader(nil, len(rows))
+	for _, row := range rows {
+		buf = appendMsgpackMapHeader(buf, len(columns))
+		for i, column := range columns {
+			buf = appendMsgpackString(buf, column)
+			var value interface{}
+			if i < len(row) {
+				value = row[i]
+			}
+			var err error
+			if buf, err = appendMsgpackValue(buf, value); err != nil {
+				return nil, fmt.Errorf("column %s: %w", column, err)
+			}
+		}
+	}
+	return buf, nil
+}
+
+func appendMsgpackValue(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(buf, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			// Out of range for float64 (e.g. a huge BIG_DECIMAL); keep the digits
+			return appendMsgpackString(buf, v.String()), nil
+		}
+		return appendMsgpackFloat(buf, f), nil
+	case float64:
+		return appendMsgpackFloat(buf, v), nil
+	case int64:
+		return appendMsgpackInt(buf, v), nil
+	case int:
+		return appendMsgpackInt(buf, int64(v)), nil
+	case string:
+		return appendMsgpackString(buf, v), nil
+	case []interface{}:
+		buf = appendMsgpackArrayHeader(buf, len(v))
+		for _, item := range v {
+			var err error
+			if buf, err = appendMsgpackValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendMsgpackMapHeader(buf, len(v))
+		for key, item := range v {
+			buf = appendMsgpackString(buf, key)
+			var err error
+			if buf, err = appendMsgpackValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(buf, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf = append(buf, 0xd1)
+		return binary.BigEndian.AppendUint16(buf, uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf = append(buf, 0xd2)
+		return binary.BigEndian.AppendUint32(buf, uint32(int32(i)))
+	default:
+		buf = append(buf, 0xd3)
+		return binary.BigEndian.AppendUint64(buf, uint64(i))
+	}
+}
+
+func appendMsgpackFloat(buf []byte, f float64) []byte {
+	buf = append(buf, 0xcb)
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdb)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendMsgpackArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xdc)
+		return binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdd)
+		return binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xde)
+		return binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdf)
+		return binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+}
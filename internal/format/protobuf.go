@@ -0,0 +1,122 @@
+package format
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufEncoder emits a qstreams.v1.ResultSet message as defined in
+// shared/proto/result.proto.
+type protobufEncoder struct{}
+
+func (protobufEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (protobufEncoder) Encode(result *Result) ([]byte, error) {
+	columns := result.Columns()
+	types := result.ColumnTypes()
+
+	var buf []byte
+	for i, column := range columns {
+		var message []byte
+		message = protowire.AppendTag(message, 1, protowire.BytesType)
+		message = protowire.AppendString(message, column)
+		if i < len(types) {
+			message = protowire.AppendTag(message, 2, protowire.BytesType)
+			message = protowire.AppendString(message, types[i])
+		}
+		buf = appendProtoMessage(buf, 1, message)
+	}
+
+	for _, row := range result.Rows() {
+		var message []byte
+		for i := range columns {
+			var value interface{}
+			if i < len(row) {
+				value = row[i]
+			}
+			dataType := ""
+			if i < len(types) {
+				dataType = types[i]
+			}
+			encoded, err := protoValue(value, dataType)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", columns[i], err)
+			}
+			message = appendProtoMessage(message, 1, encoded)
+		}
+		buf = appendProtoMessage(buf, 2, message)
+	}
+
+	if result.Chunk != nil {
+		var message []byte
+		message = protowire.AppendTag(message, 1, protowire.VarintType)
+		message = protowire.AppendVarint(message, uint64(result.Chunk.Index))
+		message = protowire.AppendTag(message, 2, protowire.VarintType)
+		message = protowire.AppendVarint(message, uint64(result.Chunk.Total))
+		buf = appendProtoMessage(buf, 3, message)
+	}
+	return buf, nil
+}
+
+// protoValue encodes a single qstreams.v1.Value message for a Pinot column type
+func protoValue(value interface{}, dataType string) ([]byte, error) {
+	var buf []byte
+	if value == nil {
+		buf = protowire.AppendTag(buf, 1, protowire.VarintType)
+		return protowire.AppendVarint(buf, 1), nil
+	}
+
+	if items, ok := value.([]interface{}); ok {
+		itemType := strings.TrimSuffix(dataType, "_ARRAY")
+		var list []byte
+		for _, item := range items {
+			encoded, err := protoValue(item, itemType)
+			if err != nil {
+				return nil, err
+			}
+			list = appendProtoMessage(list, 1, encoded)
+		}
+		return appendProtoMessage(buf, 7, list), nil
+	}
+
+	switch dataType {
+	case "INT", "LONG":
+		if i, ok := toInt64(value); ok {
+			buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+			return protowire.AppendVarint(buf, uint64(i)), nil
+		}
+	case "TIMESTAMP":
+		if i, ok := toTimestampMillis(value); ok {
+			buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+			return protowire.AppendVarint(buf, uint64(i)), nil
+		}
+	case "FLOAT", "DOUBLE":
+		if f, ok := toFloat64(value); ok {
+			buf = protowire.AppendTag(buf, 3, protowire.Fixed64Type)
+			return protowire.AppendFixed64(buf, math.Float64bits(f)), nil
+		}
+	case "BOOLEAN":
+		if b, ok := toBool(value); ok {
+			buf = protowire.AppendTag(buf, 5, protowire.VarintType)
+			return protowire.AppendVarint(buf, protowire.EncodeBool(b)), nil
+		}
+	case "BYTES":
+		// Pinot returns BYTES columns as hex strings
+		if data, err := hex.DecodeString(toString(value)); err == nil {
+			buf = protowire.AppendTag(buf, 6, protowire.BytesType)
+			return protowire.AppendBytes(buf, data), nil
+		}
+	}
+
+	buf = protowire.AppendTag(buf, 4, protowire.BytesType)
+	return protowire.AppendString(buf, toString(value)), nil
+}
+
+func appendProtoMessage(buf []byte, field protowire.Number, message []byte) []byte {
+	buf = protowire.AppendTag(buf, field, protowire.BytesType)
+	return protowire.AppendBytes(buf, message)
+}
@@ -0,0 +1,74 @@
+package format
+
+import (
+	"encoding/json"
+	"testing"
+
+	"qstreams/internal/pinot"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtobufTimestamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  int64
+	}{
+		{"pinot string", "2024-01-01 00:00:00.0", 1704067200000},
+		{"pinot string with millis", "2024-01-01 00:00:01.250", 1704067201250},
+		{"pinot string without fraction", "2024-01-01 00:00:02", 1704067202000},
+		{"rfc3339", "2024-01-01T00:00:00.5Z", 1704067200500},
+		{"epoch millis", json.Number("1704067200123"), 1704067200123},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &Result{Response: &pinot.BrokerResponse{ResultTable: &pinot.ResultTable{
+				DataSchema: pinot.DataSchema{ColumnNames: []string{"ts"}, ColumnDataTypes: []string{"TIMESTAMP"}},
+				Rows:       [][]interface{}{{tt.value}},
+			}}}
+			payload, err := protobufEncoder{}.Encode(result)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+
+			// ResultSet.rows[0].values[0].long_value
+			row := protoField(t, payload, 2)
+			value := protoField(t, row, 1)
+			field, typ, n := protowire.ConsumeTag(value)
+			if n < 0 || field != 2 || typ != protowire.VarintType {
+				t.Fatalf("value is field %d type %d, want long_value", field, typ)
+			}
+			got, m := protowire.ConsumeVarint(value[n:])
+			if m < 0 {
+				t.Fatalf("malformed long_value")
+			}
+			if int64(got) != tt.want {
+				t.Errorf("long_value = %d, want %d", int64(got), tt.want)
+			}
+		})
+	}
+}
+
+// protoField returns the first length-delimited field with the given number
+func protoField(t *testing.T, message []byte, number protowire.Number) []byte {
+	t.Helper()
+	for len(message) > 0 {
+		field, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			t.Fatalf("malformed tag")
+		}
+		message = message[n:]
+		n = protowire.ConsumeFieldValue(field, typ, message)
+		if n < 0 {
+			t.Fatalf("malformed field %d", field)
+		}
+		if field == number && typ == protowire.BytesType {
+			value, _ := protowire.ConsumeBytes(message)
+			return value
+		}
+		message = message[n:]
+	}
+	t.Fatalf("field %d not found", number)
+	return nil
+}
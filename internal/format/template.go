@@ -0,0 +1,202 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"qstreams/internal/pinot"
+	"qstreams/internal/storage"
+)
+
+// TemplateData is the value templates are executed against
+type TemplateData struct {
+	Stream    TemplateStream
+	Columns   []string
+	Types     []string
+	Rows      []map[string]interface{}
+	RawRows   [][]interface{}
+	Chunk     *ChunkInfo
+	Previous  *TemplateResult
+	Timestamp time.Time
+}
+
+type TemplateStream struct {
+	ID   string
+	Name string
+}
+
+// TemplateResult is the previous result delivered by the stream
+type TemplateResult struct {
+	Columns []string
+	Rows    []map[string]interface{}
+	RawRows [][]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// TemplateEncoder renders the delivery body with a Go text/template
+type TemplateEncoder struct {
+	body        *template.Template
+	contentType string
+}
+
+// NewTemplateEncoder parses a body template. The content type defaults to
+// application/json since most targets expect a JSON body.
+func NewTemplateEncoder(body, contentType string) (*TemplateEncoder, error) {
+	parsed, err := template.New("body").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return &TemplateEncoder{body: parsed, contentType: contentType}, nil
+}
+
+func (e *TemplateEncoder) ContentType() string { return e.contentType }
+
+func (e *TemplateEncoder) Encode(result *Result) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.body.Execute(&buf, NewTemplateData(result)); err != nil {
+		return nil, fmt.Errorf("failed to render body template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// HeaderTemplates renders per-delivery header values
+type HeaderTemplates struct {
+	headers map[string]*template.Template
+}
+
+func NewHeaderTemplates(headers map[string]string) (*HeaderTemplates, error) {
+	parsed := make(map[string]*template.Template, len(headers))
+	for name, text := range headers {
+		tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %s: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+	return &HeaderTemplates{headers: parsed}, nil
+}
+
+// Render executes every header template against result
+func (h *HeaderTemplates) Render(result *Result) (map[string]string, error) {
+	data := NewTemplateData(result)
+	headers := make(map[string]string, len(h.headers))
+	for name, tmpl := range h.headers {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render header %s: %w", name, err)
+		}
+		headers[name] = strings.TrimSpace(buf.String())
+	}
+	return headers, nil
+}
+
+// NewTemplateData builds the template view of a result
+func NewTemplateData(result *Result) TemplateData {
+	data := TemplateData{
+		Stream:    TemplateStream{ID: result.StreamID, Name: result.StreamName},
+		Columns:   result.Columns(),
+		Types:     result.ColumnTypes(),
+		Rows:      rowObjects(result.Columns(), result.Rows()),
+		RawRows:   result.Rows(),
+		Chunk:     result.Chunk,
+		Timestamp: time.Now(),
+	}
+	if result.Previous != nil {
+		var columns []string
+		if result.Previous.ResultTable != nil {
+			columns = result.Previous.ResultTable.DataSchema.ColumnNames
+		}
+		data.Previous = &TemplateResult{
+			Columns: columns,
+			Rows:    rowObjects(columns, result.Previous.Rows()),
+			RawRows: result.Previous.Rows(),
+		}
+	}
+	return data
+}
+
+// NewEncoder returns the payload encoder for a destination: its body template
+// if one is set, otherwise the encoder for its format. Header templates are
+// returned separately since they apply to either.
+func NewEncoder(config storage.DestinationConfig) (Encoder, *HeaderTemplates, error) {
+	var headerTemplates *HeaderTemplates
+	if len(config.Template.Headers) > 0 {
+		var err error
+		if headerTemplates, err = NewHeaderTemplates(config.Template.Headers); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if config.Template.Body != "" {
+		encoder, err := NewTemplateEncoder(config.Template.Body, config.Template.ContentType)
+		if err != nil {
+			return nil, nil, err
+		}
+		return encoder, headerTemplates, nil
+	}
+
+	encoder, err := Get(config.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encoder, headerTemplates, nil
+}
+
+// SampleResult returns a small synthetic result used to validate templates
+func SampleResult() *Result {
+	return &Result{
+		StreamID:   "00000000-0000-0000-0000-000000000000",
+		StreamName: "sample",
+		Response: &pinot.BrokerResponse{
+			ResultTable: &pinot.ResultTable{
+				DataSchema: pinot.DataSchema{
+					ColumnNames:     []string{"name", "value"},
+					ColumnDataTypes: []string{"STRING", "LONG"},
+				},
+				Rows: [][]interface{}{
+					{"a", json.Number("1")},
+					{"b", json.Number("2")},
+				},
+			},
+		},
+		Previous: &pinot.BrokerResponse{
+			ResultTable: &pinot.ResultTable{
+				DataSchema: pinot.DataSchema{
+					ColumnNames:     []string{"name", "value"},
+					ColumnDataTypes: []string{"STRING", "LONG"},
+				},
+				Rows: [][]interface{}{{"a", json.Number("0")}},
+			},
+		},
+	}
+}
+
+func rowObjects(columns []string, rows [][]interface{}) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		objects = append(objects, rowObject(columns, row))
+	}
+	return objects
+}
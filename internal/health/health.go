@@ -0,0 +1,221 @@
+// Package health tracks whether the server has finished starting up and
+// probes the Pinot clusters and destinations that running streams depend on.
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"qstreams/internal/auth"
+	"qstreams/internal/connections"
+	"qstreams/internal/destinations"
+	"qstreams/internal/httpclient"
+	"qstreams/internal/models"
+	"qstreams/internal/pinot"
+	"qstreams/internal/status"
+	"qstreams/internal/storage"
+)
+
+// Startup steps that must complete before the server is ready
+const (
+	StepStore   = "state_store"
+	StepMetrics = "metrics"
+	StepStreams = "streams"
+)
+
+// Kinds of dependency probed by Dependencies
+const (
+	KindPinotBroker     = "pinot_broker"
+	KindPinotController = "pinot_controller"
+	KindDestination     = "destination"
+)
+
+// CacheTTL is how long a dependency probe result is reused
+var CacheTTL = 30 * time.Second
+
+var readiness = struct {
+	sync.RWMutex
+	steps map[string]bool
+}{
+	steps: map[string]bool{StepStore: false, StepMetrics: false, StepStreams: false},
+}
+
+// MarkReady records that a startup step has completed
+func MarkReady(step string) {
+	readiness.Lock()
+	defer readiness.Unlock()
+	readiness.steps[step] = true
+}
+
+// Ready reports whether every startup step has completed, and each step's state
+func Ready() (bool, map[string]bool) {
+	readiness.RLock()
+	defer readiness.RUnlock()
+	ready := true
+	steps := make(map[string]bool, len(readiness.steps))
+	for step, done := range readiness.steps {
+		steps[step] = done
+		ready = ready && done
+	}
+	return ready, steps
+}
+
+// WhenReady answers 503 until the server is ready, then passes requests to next
+func WhenReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ready, _ := Ready(); !ready {
+			http.Error(w, "Server is starting", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// target is a dependency and the stream configuration used to probe it
+type target struct {
+	kind      string
+	name      string
+	probe     func(ctx context.Context) error
+	streamIDs []string
+}
+
+var cache = struct {
+	sync.Mutex
+	results map[string]models.DependencyStatus
+}{
+	results: make(map[string]models.DependencyStatus),
+}
+
+// Dependencies probes each distinct Pinot broker, controller and destination
+// host of the running streams, reusing results younger than CacheTTL. Only
+// one caller probes at a time; others wait and share its results.
+func Dependencies(ctx context.Context) ([]models.DependencyStatus, error) {
+	streams, err := storage.ListStreams()
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]*target)
+	add := func(kind, rawURL, streamID string, probe func(ctx context.Context) error) {
+		name := hostOf(rawURL)
+		key := kind + " " + name
+		if existing, ok := targets[key]; ok {
+			existing.streamIDs = append(existing.streamIDs, streamID)
+			return
+		}
+		targets[key] = &target{kind: kind, name: name, probe: probe, streamIDs: []string{streamID}}
+	}
+	for i := range streams {
+		stream := &streams[i]
+		if stream.State != "running" {
+			continue
+		}
+		addPinot(stream, add)
+		destination := stream.Destination
+		add(KindDestination, destination.URL, stream.StreamID, func(ctx context.Context) error {
+			dest, err := destinations.New(destination)
+			if err != nil {
+				return err
+			}
+			defer dest.Close()
+			return dest.HealthCheck(ctx)
+		})
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make([]models.DependencyStatus, 0, len(targets))
+	for key, t := range targets {
+		if cached, ok := cache.results[key]; ok && time.Since(cached.CheckedAt) < CacheTTL {
+			cached.StreamIDs = t.streamIDs
+			results = append(results, cached)
+			continue
+		}
+		wg.Add(1)
+		go func(key string, t *target) {
+			defer wg.Done()
+			start := time.Now()
+			err := t.probe(ctx)
+			result := models.DependencyStatus{
+				Kind:      t.kind,
+				Target:    t.name,
+				Healthy:   err == nil,
+				LatencyMs: time.Since(start).Milliseconds(),
+				CheckedAt: time.Now(),
+				StreamIDs: t.streamIDs,
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			cache.results[key] = result
+			results = append(results, result)
+			mu.Unlock()
+		}(key, t)
+	}
+	wg.Wait()
+
+	// Forget dependencies no running stream uses any more
+	for key := range cache.results {
+		if _, ok := targets[key]; !ok {
+			delete(cache.results, key)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Kind != results[j].Kind {
+			return results[i].Kind < results[j].Kind
+		}
+		return results[i].Target < results[j].Target
+	})
+	return results, nil
+}
+
+// addPinot adds the broker a stream queries, or its controller and the
+// brokers discovered from it, probed with the stream's resolved auth and TLS
+// settings
+func addPinot(stream *storage.QueryStream, add func(kind, rawURL, streamID string, probe func(ctx context.Context) error)) {
+	config, err := connections.Resolve(stream.Pinot)
+	if err != nil {
+		add(KindPinotBroker, "connection:"+stream.Pinot.Connection, stream.StreamID, func(context.Context) error { return err })
+		return
+	}
+	probe := func(targetURL string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			httpClient, err := httpclient.New(config.TLS)
+			if err != nil {
+				return err
+			}
+			provider, err := auth.NewProvider(config.Authentication, config.Auth, httpClient)
+			if err != nil {
+				return err
+			}
+			return pinot.NewClient(targetURL, httpClient, provider).Health(ctx)
+		}
+	}
+	if config.ControllerURL != "" {
+		add(KindPinotController, config.ControllerURL, stream.StreamID, probe(config.ControllerURL))
+		current, _ := status.Get(stream.StreamID)
+		for _, broker := range current.Brokers {
+			add(KindPinotBroker, broker.URL, stream.StreamID, probe(broker.URL))
+		}
+	} else {
+		add(KindPinotBroker, config.BrokerURL, stream.StreamID, probe(config.BrokerURL))
+	}
+}
+
+// hostOf reduces a URL to its scheme and host so paths on one host share a probe
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
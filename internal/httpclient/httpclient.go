@@ -0,0 +1,200 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"qstreams/internal/storage"
+)
+
+// DefaultTimeout is the request timeout used for Pinot and destination calls,
+// set from http.timeout in the server configuration
+var DefaultTimeout = 10 * time.Second
+
+// reloadInterval bounds how often certificate files are checked for changes
+const reloadInterval = 10 * time.Second
+
+// New returns an HTTP client for the given TLS settings. With a nil config it
+// behaves like the default client. Certificate and CA files are re-read when
+// they change on disk, so rotated certificates are picked up without a restart.
+func New(config *storage.TLSConfig) (*http.Client, error) {
+	if config == nil {
+		return &http.Client{Timeout: DefaultTimeout}, nil
+	}
+
+	tlsConfig, err := NewTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: DefaultTimeout}, nil
+}
+
+// NewTLSConfig builds a tls.Config backed by a reloader for the configured files
+func NewTLSConfig(config *storage.TLSConfig) (*tls.Config, error) {
+	minVersion, err := parseVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+
+	r := &reloader{config: config}
+	if err := r.reload(true); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CertFile != "" {
+		tlsConfig.GetClientCertificate = r.clientCertificate
+	}
+	if config.CAFile != "" && !config.InsecureSkipVerify {
+		// Verification is done by verifyConnection so that a rotated CA bundle
+		// applies to new connections without rebuilding the client.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = r.verifyConnection
+	}
+	return tlsConfig, nil
+}
+
+func parseVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tls.min_version %q is not supported (use 1.0, 1.1, 1.2 or 1.3)", version)
+	}
+}
+
+// reloader holds the current CA pool and client certificate and refreshes them
+// when the underlying files are modified.
+type reloader struct {
+	config *storage.TLSConfig
+
+	mu         sync.Mutex
+	checked    time.Time
+	caPool     *x509.CertPool
+	cert       *tls.Certificate
+	caModTime  time.Time
+	crtModTime time.Time
+	keyModTime time.Time
+}
+
+func (r *reloader) reload(force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(r.checked) < reloadInterval {
+		return nil
+	}
+	r.checked = now
+
+	if r.config.CAFile != "" {
+		modTime, err := modTime(r.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read tls.ca_file: %w", err)
+		}
+		if force || !modTime.Equal(r.caModTime) {
+			pem, err := os.ReadFile(r.config.CAFile)
+			if err != nil {
+				return fmt.Errorf("failed to read tls.ca_file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("tls.ca_file %s contains no PEM certificates", r.config.CAFile)
+			}
+			r.caPool = pool
+			r.caModTime = modTime
+		}
+	}
+
+	if r.config.CertFile != "" {
+		crtModTime, err := modTime(r.config.CertFile)
+		if err != nil {
+			return fmt.Errorf("failed to read tls.cert_file: %w", err)
+		}
+		keyModTime, err := modTime(r.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read tls.key_file: %w", err)
+		}
+		if force || !crtModTime.Equal(r.crtModTime) || !keyModTime.Equal(r.keyModTime) {
+			cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			r.cert = &cert
+			r.crtModTime = crtModTime
+			r.keyModTime = keyModTime
+		}
+	}
+
+	return nil
+}
+
+// refresh reloads changed files, keeping the previous material if the new
+// files cannot be loaded (for example while a rotation is half written).
+func (r *reloader) refresh() {
+	_ = r.reload(false)
+}
+
+func (r *reloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.refresh()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
+
+func (r *reloader) verifyConnection(state tls.ConnectionState) error {
+	r.refresh()
+
+	r.mu.Lock()
+	pool := r.caPool
+	r.mu.Unlock()
+
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificates")
+	}
+
+	serverName := r.config.ServerName
+	if serverName == "" {
+		serverName = state.ServerName
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         pool,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -1,7 +1,7 @@
 package metrics
 
 import (
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -26,7 +26,7 @@ func LoadMetrics() error {
 	Cache.Lock()
 	defer Cache.Unlock()
 	Cache.Data = metrics
-	log.Printf("Loaded metrics for %d stream(s) from disk.", len(metrics))
+	slog.Info("Loaded metrics from state store", "streams", len(metrics))
 	return nil
 }
 
@@ -36,17 +36,22 @@ func SaveMetricsFlush(interval time.Duration) {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		Cache.Lock()
-		data := make(map[string]models.StreamMetrics)
-		for k, v := range Cache.Data {
-			data[k] = v
-		}
-		Cache.Unlock()
-
-		if err := storage.SaveAllMetrics(data); err != nil {
-			log.Printf("Failed to flush metrics to disk: %v", err)
+		if err := Flush(); err != nil {
+			slog.Error("Failed to flush metrics", "error", err)
 		} else {
-			log.Println("Metrics successfully flushed to disk.")
+			slog.Debug("Metrics flushed")
 		}
 	}
-}
\ No newline at end of file
+}
+
+// Flush writes the in-memory metrics to the state store.
+func Flush() error {
+	Cache.Lock()
+	data := make(map[string]models.StreamMetrics)
+	for k, v := range Cache.Data {
+		data[k] = v
+	}
+	Cache.Unlock()
+
+	return storage.SaveAllMetrics(data)
+}
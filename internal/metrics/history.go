@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"qstreams/internal/models"
+	"qstreams/internal/storage"
+	"qstreams/shared/utils"
+)
+
+// History holds the time series of each stream. Every minute the growth of
+// the Cache counters since the previous minute is rolled up into a point,
+// together with the latency of the queries observed in that minute. Minutes
+// older than the minute retention are downsampled into hourly points, which
+// are dropped after the hour retention.
+var History = struct {
+	sync.Mutex
+	Data map[string]*models.MetricsHistory
+
+	minuteRetention time.Duration
+	hourRetention   time.Duration
+	// baseline is the Cache at the last rollup; pending collects the
+	// latency of the current minute
+	baseline map[string]models.StreamMetrics
+	pending  map[string]*models.MetricsPoint
+}{
+	Data:            make(map[string]*models.MetricsHistory),
+	minuteRetention: 24 * time.Hour,
+	hourRetention:   30 * 24 * time.Hour,
+	baseline:        make(map[string]models.StreamMetrics),
+	pending:         make(map[string]*models.MetricsPoint),
+}
+
+// RunHistory rolls up the metrics of every stream at the end of each minute
+func RunHistory(minuteRetention, hourRetention time.Duration) {
+	History.Lock()
+	History.minuteRetention = minuteRetention
+	History.hourRetention = hourRetention
+	History.baseline = snapshot()
+	History.Unlock()
+
+	for {
+		end := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(end))
+		rollup(end.Add(-time.Minute))
+	}
+}
+
+// snapshot copies the cumulative counters of every stream
+func snapshot() map[string]models.StreamMetrics {
+	Cache.Lock()
+	defer Cache.Unlock()
+	data := make(map[string]models.StreamMetrics, len(Cache.Data))
+	for streamID, m := range Cache.Data {
+		data[streamID] = m
+	}
+	return data
+}
+
+// rollup records the minute starting at start for every stream and persists
+// the histories that changed
+func rollup(start time.Time) {
+	History.Lock()
+	defer History.Unlock()
+
+	// Cache is read under the History lock so a stream deleted meanwhile is
+	// either missing here or has its history deleted after this rollup
+	current := snapshot()
+	for streamID, m := range current {
+		before := History.baseline[streamID]
+		point := models.MetricsPoint{
+			Start:          start,
+			Queries:        growth(m.NumberOfQueries, before.NumberOfQueries),
+			EventsSent:     growth(m.EventsSent, before.EventsSent),
+			EventsDeduped:  growth(m.EventsDeduped, before.EventsDeduped),
+			QueryErrors:    growth(m.QueryErrors, before.QueryErrors),
+			DeliveryErrors: growth(m.DeliveryErrors, before.DeliveryErrors),
+		}
+		if latency, ok := History.pending[streamID]; ok {
+			point.Add(*latency)
+		}
+
+		history := loadHistory(streamID)
+		changed := false
+		if point.Queries+point.EventsSent+point.EventsDeduped+point.QueryErrors+point.DeliveryErrors > 0 || len(point.LatencyBuckets) > 0 {
+			history.Minutes = append(history.Minutes, point)
+			changed = true
+		}
+		if downsample(history, start) {
+			changed = true
+		}
+		if changed {
+			if err := storage.SaveMetricsHistory(streamID, *history); err != nil {
+				slog.Error("Failed to save metrics history", utils.FieldStreamID, streamID, "error", err)
+			}
+		}
+	}
+	History.baseline = current
+	History.pending = make(map[string]*models.MetricsPoint)
+}
+
+// growth is the increase of a counter, or zero if it went backwards
+func growth(now, before int) int {
+	if now < before {
+		return 0
+	}
+	return now - before
+}
+
+// loadHistory returns the history of a stream, reading it from the state
+// store the first time. The History lock must be held.
+func loadHistory(streamID string) *models.MetricsHistory {
+	if history, ok := History.Data[streamID]; ok {
+		return history
+	}
+	history, _, err := storage.LoadMetricsHistory(streamID)
+	if err != nil {
+		slog.Error("Failed to load metrics history", utils.FieldStreamID, streamID, "error", err)
+	}
+	History.Data[streamID] = &history
+	return &history
+}
+
+// downsample folds minutes older than the minute retention into hourly
+// points and drops hours older than the hour retention
+func downsample(history *models.MetricsHistory, now time.Time) bool {
+	changed := false
+	minuteCutoff := now.Add(-History.minuteRetention)
+	expired := 0
+	for expired < len(history.Minutes) && history.Minutes[expired].Start.Before(minuteCutoff) {
+		minute := history.Minutes[expired]
+		hour := minute.Start.Truncate(time.Hour)
+		if last := len(history.Hours) - 1; last >= 0 && history.Hours[last].Start.Equal(hour) {
+			history.Hours[last].Add(minute)
+		} else {
+			point := models.MetricsPoint{Start: hour}
+			point.Add(minute)
+			history.Hours = append(history.Hours, point)
+		}
+		expired++
+	}
+	if expired > 0 {
+		history.Minutes = append([]models.MetricsPoint(nil), history.Minutes[expired:]...)
+		changed = true
+	}
+
+	hourCutoff := now.Add(-History.hourRetention).Truncate(time.Hour)
+	expired = 0
+	for expired < len(history.Hours) && history.Hours[expired].Start.Before(hourCutoff) {
+		expired++
+	}
+	if expired > 0 {
+		history.Hours = append([]models.MetricsPoint(nil), history.Hours[expired:]...)
+		changed = true
+	}
+	return changed
+}
+
+// observeLatency adds a query to the latency of the current minute
+func observeLatency(streamID string, ms int64) {
+	History.Lock()
+	defer History.Unlock()
+
+	point, ok := History.pending[streamID]
+	if !ok {
+		point = &models.MetricsPoint{LatencyBuckets: make([]int, len(models.LatencyBoundsMs)+1)}
+		History.pending[streamID] = point
+	}
+	bucket := len(models.LatencyBoundsMs)
+	for i, bound := range models.LatencyBoundsMs {
+		if ms <= bound {
+			bucket = i
+			break
+		}
+	}
+	point.LatencyBuckets[bucket]++
+	point.LatencySumMs += ms
+	if ms > point.LatencyMaxMs {
+		point.LatencyMaxMs = ms
+	}
+}
+
+// HistorySamples merges a stream's minutes and hours into samples of length
+// step covering from to to. Steps without activity are returned as zeros.
+func HistorySamples(streamID string, from, to time.Time, step time.Duration) []models.MetricsSample {
+	History.Lock()
+	defer History.Unlock()
+
+	start := from.Truncate(step)
+	points := make([]models.MetricsPoint, (to.Sub(start)+step-1)/step)
+	for i := range points {
+		points[i].Start = start.Add(time.Duration(i) * step)
+	}
+	history := loadHistory(streamID)
+	for _, series := range [][]models.MetricsPoint{history.Hours, history.Minutes} {
+		for _, point := range series {
+			if point.Start.Before(start) || !point.Start.Before(to) {
+				continue
+			}
+			points[point.Start.Sub(start)/step].Add(point)
+		}
+	}
+
+	samples := make([]models.MetricsSample, len(points))
+	for i, point := range points {
+		samples[i] = models.MetricsSample{
+			Start:          point.Start,
+			Queries:        point.Queries,
+			EventsSent:     point.EventsSent,
+			EventsDeduped:  point.EventsDeduped,
+			QueryErrors:    point.QueryErrors,
+			DeliveryErrors: point.DeliveryErrors,
+			MaxQueryMs:     point.LatencyMaxMs,
+		}
+		count := 0
+		for _, n := range point.LatencyBuckets {
+			count += n
+		}
+		if count > 0 {
+			samples[i].AvgQueryMs = point.LatencySumMs / int64(count)
+			samples[i].P50QueryMs = bucketPercentile(point, count, 50)
+			samples[i].P95QueryMs = bucketPercentile(point, count, 95)
+		}
+	}
+	return samples
+}
+
+// bucketPercentile returns the upper bound of the latency bucket holding the
+// nearest-rank percentile, capped at the slowest query
+func bucketPercentile(point models.MetricsPoint, count, p int) int64 {
+	rank := (p*count + 99) / 100
+	seen := 0
+	for i, n := range point.LatencyBuckets {
+		seen += n
+		if seen >= rank && i < len(models.LatencyBoundsMs) {
+			return min(models.LatencyBoundsMs[i], point.LatencyMaxMs)
+		}
+	}
+	return point.LatencyMaxMs
+}
+
+// deleteHistory drops a deleted stream's history
+func deleteHistory(streamID string) {
+	History.Lock()
+	defer History.Unlock()
+
+	delete(History.Data, streamID)
+	delete(History.baseline, streamID)
+	delete(History.pending, streamID)
+	if err := storage.DeleteMetricsHistory(streamID); err != nil {
+		slog.Error("Failed to delete metrics history", utils.FieldStreamID, streamID, "error", err)
+	}
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+
+	"qstreams/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the metrics served in the Prometheus text format. Counters
+// are read from Cache when scraped, so they keep counting across restarts;
+// latency histograms and the worker gauge start empty with the process.
+var Registry = prometheus.NewRegistry()
+
+var (
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qstreams_pinot_query_duration_seconds",
+		Help:    "Time taken by Pinot queries, including pagination and failover.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"stream_id"})
+
+	deliveryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qstreams_delivery_duration_seconds",
+		Help:    "Time taken to deliver a chunk to the destination.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"stream_id", "destination"})
+
+	runningWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "qstreams_running_workers",
+		Help: "Number of stream workers currently running.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		queryDuration,
+		deliveryDuration,
+		runningWorkers,
+		cacheCollector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// PrometheusHandler serves Registry in the Prometheus text format
+func PrometheusHandler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveQuery counts an executed Pinot query, whether or not it succeeded,
+// and records its duration, also in the stream's history
+func ObserveQuery(streamID string, seconds float64) {
+	Cache.Lock()
+	metricsData := Cache.Data[streamID]
+	metricsData.NumberOfQueries++
+	Cache.Data[streamID] = metricsData
+	Cache.Unlock()
+
+	queryDuration.WithLabelValues(streamID).Observe(seconds)
+	observeLatency(streamID, int64(seconds*1000))
+}
+
+// ObserveDelivery records the duration of a chunk delivery
+func ObserveDelivery(streamID, destination string, seconds float64) {
+	deliveryDuration.WithLabelValues(streamID, destination).Observe(seconds)
+}
+
+// WorkerStarted and WorkerStopped track the running workers gauge
+func WorkerStarted() { runningWorkers.Inc() }
+func WorkerStopped() { runningWorkers.Dec() }
+
+// RecordRetry counts a delivery that was retried by its destination
+func RecordRetry(streamID string) {
+	Cache.Lock()
+	defer Cache.Unlock()
+	metricsData := Cache.Data[streamID]
+	metricsData.Retries++
+	Cache.Data[streamID] = metricsData
+}
+
+// deletePrometheus drops a deleted stream's histogram series
+func deletePrometheus(streamID string) {
+	queryDuration.DeletePartialMatch(prometheus.Labels{"stream_id": streamID})
+	deliveryDuration.DeletePartialMatch(prometheus.Labels{"stream_id": streamID})
+}
+
+var (
+	queriesDesc        = prometheus.NewDesc("qstreams_queries_total", "Pinot queries executed, including failed ones.", []string{"stream_id"}, nil)
+	queryErrorsDesc    = prometheus.NewDesc("qstreams_query_errors_total", "Failed or partial Pinot queries by error class.", []string{"stream_id", "class"}, nil)
+	deliveriesDesc     = prometheus.NewDesc("qstreams_deliveries_total", "Chunk deliveries attempted.", []string{"stream_id"}, nil)
+	deliveryErrorsDesc = prometheus.NewDesc("qstreams_delivery_errors_total", "Chunk deliveries that failed.", []string{"stream_id"}, nil)
+	retriesDesc        = prometheus.NewDesc("qstreams_delivery_retries_total", "Deliveries retried by the destination.", []string{"stream_id"}, nil)
+	dedupesDesc        = prometheus.NewDesc("qstreams_dedupes_total", "Query results skipped as duplicates.", []string{"stream_id"}, nil)
+	bytesDesc          = prometheus.NewDesc("qstreams_delivered_bytes_total", "Payload bytes delivered, before and after compression.", []string{"stream_id", "stage"}, nil)
+	streamsDesc        = prometheus.NewDesc("qstreams_streams", "Streams in the state store by state.", []string{"state"}, nil)
+)
+
+// cacheCollector exposes the counters kept in Cache and the stream states
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{queriesDesc, queryErrorsDesc, deliveriesDesc, deliveryErrorsDesc, retriesDesc, dedupesDesc, bytesDesc, streamsDesc} {
+		ch <- desc
+	}
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	Cache.Lock()
+	streamIDs := make([]string, 0, len(Cache.Data))
+	for streamID := range Cache.Data {
+		streamIDs = append(streamIDs, streamID)
+	}
+	sort.Strings(streamIDs)
+	for _, streamID := range streamIDs {
+		m := Cache.Data[streamID]
+		counter := func(desc *prometheus.Desc, value float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, append([]string{streamID}, labels...)...)
+		}
+		counter(queriesDesc, float64(m.NumberOfQueries))
+		for class, count := range m.ErrorsByClass {
+			counter(queryErrorsDesc, float64(count), class)
+		}
+		counter(deliveriesDesc, float64(m.EventsSent))
+		counter(deliveryErrorsDesc, float64(m.DeliveryErrors))
+		counter(retriesDesc, float64(m.Retries))
+		counter(dedupesDesc, float64(m.EventsDeduped))
+		counter(bytesDesc, float64(m.BytesBeforeCompression), "uncompressed")
+		counter(bytesDesc, float64(m.BytesAfterCompression), "compressed")
+	}
+	Cache.Unlock()
+
+	// Stream states are read from the store as saved, without opening secrets
+	streams, err := storage.Current().ListStreams()
+	if err != nil {
+		return
+	}
+	states := map[string]int{"running": 0, "stopped": 0}
+	for _, stream := range streams {
+		state := stream.State
+		if state == "" {
+			state = "unknown"
+		}
+		states[state]++
+	}
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(streamsDesc, prometheus.GaugeValue, float64(count), state)
+	}
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+
+	"qstreams/internal/models"
+	"qstreams/internal/storage"
+)
+
+// statsWindow is the number of recent executions kept per stream for
+// latency percentiles
+const statsWindow = 1000
+
+type queryStats struct {
+	thresholds storage.CostThresholds
+	samples    []models.QuerySample
+	next       int
+	totals     models.QueryStats
+}
+
+var Stats = struct {
+	sync.Mutex
+	Data map[string]*queryStats
+}{
+	Data: make(map[string]*queryStats),
+}
+
+// RecordQuery adds one execution of a stream's query to its stats
+func RecordQuery(streamID string, thresholds storage.CostThresholds, sample models.QuerySample) {
+	Stats.Lock()
+	defer Stats.Unlock()
+
+	stats, ok := Stats.Data[streamID]
+	if !ok {
+		stats = &queryStats{}
+		Stats.Data[streamID] = stats
+	}
+	stats.thresholds = thresholds
+
+	if len(stats.samples) < statsWindow {
+		stats.samples = append(stats.samples, sample)
+	} else {
+		stats.samples[stats.next] = sample
+		stats.next = (stats.next + 1) % statsWindow
+	}
+
+	stats.totals.Executions++
+	stats.totals.TotalDocsScanned += sample.NumDocsScanned
+	stats.totals.TotalEntriesScannedInFilter += sample.NumEntriesScannedInFilter
+	stats.totals.TotalEntriesScannedPostFilter += sample.NumEntriesScannedPostFilter
+}
+
+// QueryStats summarises a stream's executions, or returns nil when its query
+// has not run since the server started
+func QueryStats(streamID string) *models.QueryStats {
+	Stats.Lock()
+	defer Stats.Unlock()
+
+	stats, ok := Stats.Data[streamID]
+	if !ok || len(stats.samples) == 0 {
+		return nil
+	}
+
+	summary := stats.totals
+	times := make([]int64, len(stats.samples))
+	for i, sample := range stats.samples {
+		times[i] = sample.TimeUsedMs
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	summary.P50TimeMs = percentile(times, 50)
+	summary.P95TimeMs = percentile(times, 95)
+	summary.MaxTimeMs = times[len(times)-1]
+	summary.AvgDocsScanned = summary.TotalDocsScanned / summary.Executions
+
+	last := stats.samples[(stats.next+len(stats.samples)-1)%len(stats.samples)]
+	summary.Last = &last
+
+	if stats.thresholds.SlowQueryMs > 0 && summary.P95TimeMs > stats.thresholds.SlowQueryMs {
+		summary.Slow = true
+	}
+	if stats.thresholds.MaxDocsScanned > 0 && summary.AvgDocsScanned > stats.thresholds.MaxDocsScanned {
+		summary.Expensive = true
+	}
+	return &summary
+}
+
+// RecentQueries returns up to limit of a stream's most recent executions,
+// newest first
+func RecentQueries(streamID string, limit int) []models.QuerySample {
+	Stats.Lock()
+	defer Stats.Unlock()
+
+	stats, ok := Stats.Data[streamID]
+	if !ok {
+		return nil
+	}
+	if limit > len(stats.samples) {
+		limit = len(stats.samples)
+	}
+	recent := make([]models.QuerySample, limit)
+	for i := range recent {
+		recent[i] = stats.samples[(stats.next+len(stats.samples)-1-i)%len(stats.samples)]
+	}
+	return recent
+}
+
+// DeleteStats removes the stats of a deleted stream
+func DeleteStats(streamID string) {
+	Stats.Lock()
+	defer Stats.Unlock()
+	delete(Stats.Data, streamID)
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
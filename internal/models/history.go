@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// LatencyBoundsMs are the upper bounds of the query latency buckets kept in
+// each MetricsPoint; a final bucket counts slower queries
+var LatencyBoundsMs = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// MetricsPoint is a stream's activity during one minute or one hour
+type MetricsPoint struct {
+	Start          time.Time `json:"start"`
+	Queries        int       `json:"queries"`
+	EventsSent     int       `json:"events_sent"`
+	EventsDeduped  int       `json:"events_deduped"`
+	QueryErrors    int       `json:"query_errors"`
+	DeliveryErrors int       `json:"delivery_errors"`
+	// LatencyBuckets counts queries by duration, bounded by LatencyBoundsMs
+	LatencyBuckets []int `json:"latency_buckets,omitempty"`
+	LatencySumMs   int64 `json:"latency_sum_ms"`
+	LatencyMaxMs   int64 `json:"latency_max_ms"`
+}
+
+// Add merges other into p, keeping p's start
+func (p *MetricsPoint) Add(other MetricsPoint) {
+	p.Queries += other.Queries
+	p.EventsSent += other.EventsSent
+	p.EventsDeduped += other.EventsDeduped
+	p.QueryErrors += other.QueryErrors
+	p.DeliveryErrors += other.DeliveryErrors
+	if len(other.LatencyBuckets) > 0 && len(p.LatencyBuckets) == 0 {
+		p.LatencyBuckets = make([]int, len(LatencyBoundsMs)+1)
+	}
+	for i, count := range other.LatencyBuckets {
+		p.LatencyBuckets[i] += count
+	}
+	p.LatencySumMs += other.LatencySumMs
+	if other.LatencyMaxMs > p.LatencyMaxMs {
+		p.LatencyMaxMs = other.LatencyMaxMs
+	}
+}
+
+// MetricsHistory is the persisted time series of a stream: per-minute points
+// for the recent window and hourly points downsampled from older minutes
+type MetricsHistory struct {
+	Minutes []MetricsPoint `json:"minutes"`
+	Hours   []MetricsPoint `json:"hours"`
+}
+
+// MetricsSample is one step of a metrics history query
+type MetricsSample struct {
+	Start          time.Time `json:"start"`
+	Queries        int       `json:"queries"`
+	EventsSent     int       `json:"events_sent"`
+	EventsDeduped  int       `json:"events_deduped"`
+	QueryErrors    int       `json:"query_errors"`
+	DeliveryErrors int       `json:"delivery_errors"`
+	AvgQueryMs     int64     `json:"avg_query_ms"`
+	P50QueryMs     int64     `json:"p50_query_ms"`
+	P95QueryMs     int64     `json:"p95_query_ms"`
+	MaxQueryMs     int64     `json:"max_query_ms"`
+}
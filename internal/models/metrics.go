@@ -1,8 +1,19 @@
 package models
 
 type StreamMetrics struct {
-	StreamID       string `json:"stream_id"`
-	EventsSent     int    `json:"events_sent"`
-	EventsDeduped  int    `json:"events_deduped"`
-	NumberOfQueries int    `json:"number_of_queries"`
-}
\ No newline at end of file
+	StreamID               string `json:"stream_id"`
+	EventsSent             int    `json:"events_sent"`
+	EventsDeduped          int    `json:"events_deduped"`
+	NumberOfQueries        int    `json:"number_of_queries"`
+	BytesBeforeCompression int64  `json:"bytes_before_compression"`
+	BytesAfterCompression  int64  `json:"bytes_after_compression"`
+	EventSequence          int64  `json:"event_sequence"`
+	QueryErrors            int    `json:"query_errors"`
+	PartialResults         int    `json:"partial_results"`
+	DeliveryErrors         int    `json:"delivery_errors"`
+	Retries                int    `json:"retries"`
+	// ErrorsByClass counts query errors by class (syntax, timeout, partial, ...)
+	ErrorsByClass map[string]int `json:"errors_by_class,omitempty"`
+	// QueryStats is filled in when metrics are served and is not persisted
+	QueryStats *QueryStats `json:"query_stats,omitempty"`
+}
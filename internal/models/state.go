@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// DedupeState is the hash of the last result delivered by a stream
+type DedupeState struct {
+	Hash     string    `json:"hash"`
+	LastSent time.Time `json:"last_sent"`
+}
+
+// DeliveryRecord is one attempt to push a chunk to a stream's destination
+type DeliveryRecord struct {
+	At         time.Time `json:"at"`
+	Sequence   int64     `json:"sequence,omitempty"`
+	ChunkIndex int       `json:"chunk_index"`
+	ChunkTotal int       `json:"chunk_total"`
+	Rows       int       `json:"rows"`
+	Bytes      int       `json:"bytes"`
+	DurationMs int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// QuarantinedFile is a state file that could not be decoded and was moved
+// aside so it is neither loaded nor overwritten
+type QuarantinedFile struct {
+	Kind          string    `json:"kind"`
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+	Error         string    `json:"error,omitempty"`
+}
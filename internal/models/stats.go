@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// QuerySample is the cost of one execution of a stream's query, as reported
+// by the broker. Paginated queries report the sum over all pages.
+type QuerySample struct {
+	At                          time.Time `json:"at"`
+	TimeUsedMs                  int64     `json:"time_used_ms"`
+	NumDocsScanned              int64     `json:"num_docs_scanned"`
+	NumEntriesScannedInFilter   int64     `json:"num_entries_scanned_in_filter"`
+	NumEntriesScannedPostFilter int64     `json:"num_entries_scanned_post_filter"`
+	NumServersQueried           int       `json:"num_servers_queried"`
+	NumServersResponded         int       `json:"num_servers_responded"`
+	NumSegmentsQueried          int64     `json:"num_segments_queried"`
+	NumSegmentsProcessed        int64     `json:"num_segments_processed"`
+	NumSegmentsMatched          int64     `json:"num_segments_matched"`
+	TotalDocs                   int64     `json:"total_docs"`
+	NumRows                     int       `json:"num_rows"`
+}
+
+// QueryStats summarises the recent executions of a stream's query. Latency
+// percentiles cover the retained window; totals cover every execution since
+// the server started.
+type QueryStats struct {
+	Executions                    int64        `json:"executions"`
+	P50TimeMs                     int64        `json:"p50_time_ms"`
+	P95TimeMs                     int64        `json:"p95_time_ms"`
+	MaxTimeMs                     int64        `json:"max_time_ms"`
+	TotalDocsScanned              int64        `json:"total_docs_scanned"`
+	TotalEntriesScannedInFilter   int64        `json:"total_entries_scanned_in_filter"`
+	TotalEntriesScannedPostFilter int64        `json:"total_entries_scanned_post_filter"`
+	AvgDocsScanned                int64        `json:"avg_docs_scanned"`
+	Slow                          bool         `json:"slow"`
+	Expensive                     bool         `json:"expensive"`
+	Last                          *QuerySample `json:"last,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// StreamStatus is the runtime view of a stream's worker. It is rebuilt when
+// the worker starts and is not persisted.
+type StreamStatus struct {
+	StreamID  string         `json:"stream_id"`
+	Brokers   []BrokerStatus `json:"brokers,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+
+	// IntervalMs is the query interval the worker is running with
+	IntervalMs     int64      `json:"interval_ms,omitempty"`
+	LastQueryAt    *time.Time `json:"last_query_at,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"`
+	LastRows       int        `json:"last_rows"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+
+	// LastError is the last failed query or delivery; ConsecutiveErrors
+	// counts runs that failed since the last clean one
+	LastError         *QueryError `json:"last_error,omitempty"`
+	ConsecutiveErrors int         `json:"consecutive_errors"`
+}
+
+// QueryError is the last failed or partial query of a stream, or its last
+// failed delivery with class "delivery"
+type QueryError struct {
+	Class     string    `json:"class"`
+	Code      int       `json:"code,omitempty"`
+	Message   string    `json:"message"`
+	Delivered bool      `json:"delivered"`
+	At        time.Time `json:"at"`
+}
+
+// BrokerStatus is a broker discovered from the Pinot controller
+type BrokerStatus struct {
+	URL       string     `json:"url"`
+	Instance  string     `json:"instance"`
+	Healthy   bool       `json:"healthy"`
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+}
+
+// DependencyStatus is the last probe of a Pinot broker or controller, or a
+// destination host, used by running streams
+type DependencyStatus struct {
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Healthy   bool      `json:"healthy"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	StreamIDs []string  `json:"stream_ids"`
+}
@@ -0,0 +1,219 @@
+package pinot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"qstreams/internal/auth"
+)
+
+const (
+	// DefaultRefreshInterval is how often discovered brokers are refreshed
+	DefaultRefreshInterval = 30 * time.Second
+
+	// brokerCooldown is how long a failed broker is skipped before it is retried
+	brokerCooldown = 30 * time.Second
+)
+
+var fromClause = regexp.MustCompile("(?i)\\bFROM\\s+([\"`]?)([A-Za-z0-9_.\\-]+)([\"`]?)")
+
+// Broker is a discovered broker and its health as seen by this stream
+type Broker struct {
+	URL       string
+	Instance  string
+	Healthy   bool
+	LastError string
+	FailedAt  *time.Time
+}
+
+// BrokerPool discovers the brokers serving a table from a Pinot controller and
+// hands them out round-robin, skipping brokers that recently failed.
+type BrokerPool struct {
+	ControllerURL   string
+	Table           string
+	RefreshInterval time.Duration
+	HTTP            *http.Client
+	Auth            auth.Provider
+
+	mu          sync.Mutex
+	brokers     []*Broker
+	next        int
+	refreshedAt time.Time
+}
+
+func NewBrokerPool(controllerURL, table string, refreshInterval time.Duration, httpClient *http.Client, provider auth.Provider) *BrokerPool {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultRefreshInterval
+	}
+	return &BrokerPool{
+		ControllerURL:   strings.TrimRight(controllerURL, "/"),
+		Table:           table,
+		RefreshInterval: refreshInterval,
+		HTTP:            httpClient,
+		Auth:            provider,
+	}
+}
+
+// TableFromQuery returns the first table named in a FROM clause of query
+func TableFromQuery(query string) string {
+	match := fromClause.FindStringSubmatch(query)
+	if match == nil {
+		return ""
+	}
+	return match[2]
+}
+
+// Candidates returns the brokers to try for the next query: healthy brokers
+// in round-robin order followed by brokers still cooling down, so a query is
+// attempted even when every broker has failed. Discovery is refreshed first
+// when the broker list is stale.
+func (p *BrokerPool) Candidates(ctx context.Context) ([]string, error) {
+	p.mu.Lock()
+	stale := time.Since(p.refreshedAt) >= p.RefreshInterval
+	p.mu.Unlock()
+
+	if stale {
+		if err := p.Refresh(ctx); err != nil {
+			p.mu.Lock()
+			empty := len(p.brokers) == 0
+			if !empty {
+				// Keep using the brokers discovered last time and retry
+				// discovery after RefreshInterval rather than on every query
+				p.refreshedAt = time.Now()
+			}
+			p.mu.Unlock()
+			if empty {
+				return nil, err
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy, failed []string
+	for i := range p.brokers {
+		broker := p.brokers[(p.next+i)%len(p.brokers)]
+		if !broker.Healthy && broker.FailedAt != nil && time.Since(*broker.FailedAt) >= brokerCooldown {
+			broker.Healthy = true
+		}
+		if broker.Healthy {
+			healthy = append(healthy, broker.URL)
+		} else {
+			failed = append(failed, broker.URL)
+		}
+	}
+	if len(p.brokers) > 0 {
+		p.next = (p.next + 1) % len(p.brokers)
+	}
+	return append(healthy, failed...), nil
+}
+
+// Refresh asks the controller for the brokers serving the table. Health of
+// brokers that are still present is kept.
+func (p *BrokerPool) Refresh(ctx context.Context) error {
+	controller, err := url.Parse(p.ControllerURL)
+	if err != nil {
+		return fmt.Errorf("invalid controller URL: %w", err)
+	}
+
+	target := fmt.Sprintf("%s/v2/brokers/tables/%s", p.ControllerURL, url.PathEscape(p.Table))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create broker discovery request: %w", err)
+	}
+	if err := p.Auth.Apply(req); err != nil {
+		return fmt.Errorf("failed to authenticate Pinot request: %w", err)
+	}
+
+	resp, err := p.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to discover brokers: %w", err)
+	}
+	defer resp.Body.Close()
+	auth.Rejected(p.Auth, resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("broker discovery for table '%s' failed with status %d", p.Table, resp.StatusCode)
+	}
+
+	var instances []struct {
+		InstanceName string `json:"instanceName"`
+		Host         string `json:"host"`
+		Port         int    `json:"port"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return fmt.Errorf("failed to decode broker discovery response: %w", err)
+	}
+	if len(instances) == 0 {
+		return fmt.Errorf("no brokers serve table '%s'", p.Table)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := map[string]*Broker{}
+	for _, broker := range p.brokers {
+		previous[broker.URL] = broker
+	}
+	brokers := make([]*Broker, 0, len(instances))
+	for _, instance := range instances {
+		// Brokers are reached with the same scheme as the controller
+		brokerURL := fmt.Sprintf("%s://%s:%d", controller.Scheme, instance.Host, instance.Port)
+		if broker, ok := previous[brokerURL]; ok {
+			brokers = append(brokers, broker)
+			continue
+		}
+		brokers = append(brokers, &Broker{URL: brokerURL, Instance: instance.InstanceName, Healthy: true})
+	}
+	p.brokers = brokers
+	p.refreshedAt = time.Now()
+	if p.next >= len(brokers) {
+		p.next = 0
+	}
+	return nil
+}
+
+// MarkFailed takes a broker out of rotation until its cooldown expires
+func (p *BrokerPool) MarkFailed(brokerURL string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, broker := range p.brokers {
+		if broker.URL == brokerURL {
+			broker.Healthy = false
+			broker.LastError = err.Error()
+			now := time.Now()
+			broker.FailedAt = &now
+		}
+	}
+}
+
+// MarkHealthy returns a broker to rotation after a successful query
+func (p *BrokerPool) MarkHealthy(brokerURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, broker := range p.brokers {
+		if broker.URL == brokerURL {
+			broker.Healthy = true
+			broker.LastError = ""
+		}
+	}
+}
+
+// Brokers returns a snapshot of the discovered brokers
+func (p *BrokerPool) Brokers() []Broker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	brokers := make([]Broker, len(p.brokers))
+	for i, broker := range p.brokers {
+		brokers[i] = *broker
+	}
+	return brokers
+}
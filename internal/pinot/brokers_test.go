@@ -0,0 +1,77 @@
+package pinot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qstreams/internal/auth"
+)
+
+func TestCandidatesKeepBrokersWhenDiscoveryFails(t *testing.T) {
+	var requests, failing int32
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"instanceName":"Broker_b1_8099","host":"b1","port":8099},{"instanceName":"Broker_b2_8099","host":"b2","port":8099}]`))
+	}))
+	defer controller.Close()
+
+	provider, err := auth.NewProvider(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	pool := NewBrokerPool(controller.URL, "t", time.Hour, controller.Client(), provider)
+
+	brokers, err := pool.Candidates(context.Background())
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if want := []string{"http://b1:8099", "http://b2:8099"}; !reflect.DeepEqual(brokers, want) {
+		t.Fatalf("Candidates = %v, want %v", brokers, want)
+	}
+
+	// Make the list stale while the controller is down
+	atomic.StoreInt32(&failing, 1)
+	pool.mu.Lock()
+	pool.refreshedAt = time.Time{}
+	pool.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		brokers, err := pool.Candidates(context.Background())
+		if err != nil {
+			t.Fatalf("Candidates with cached brokers: %v", err)
+		}
+		if len(brokers) != 2 {
+			t.Fatalf("Candidates returned %d brokers, want the 2 cached", len(brokers))
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("controller called %d times, want 2: failed discovery must wait for the refresh interval", n)
+	}
+}
+
+func TestCandidatesWithoutBrokers(t *testing.T) {
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer controller.Close()
+
+	provider, err := auth.NewProvider(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	pool := NewBrokerPool(controller.URL, "t", time.Hour, controller.Client(), provider)
+	for i := 0; i < 2; i++ {
+		if _, err := pool.Candidates(context.Background()); err == nil {
+			t.Fatalf("Candidates succeeded without any discovered broker")
+		}
+	}
+}
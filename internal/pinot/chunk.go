@@ -0,0 +1,41 @@
+package pinot
+
+// Chunk is a slice of a result's rows delivered as one payload
+type Chunk struct {
+	Index int
+	Total int
+	Rows  [][]interface{}
+}
+
+// Split divides rows into chunks holding at most maxRows rows and roughly
+// maxBytes of encoded row data. A zero limit disables that bound. A single
+// row larger than maxBytes is delivered in a chunk of its own. An empty
+// result yields one empty chunk so that empty results are still delivered.
+func Split(rows [][]interface{}, maxRows, maxBytes int) []Chunk {
+	if maxRows <= 0 && maxBytes <= 0 {
+		return []Chunk{{Index: 0, Total: 1, Rows: rows}}
+	}
+
+	var groups [][][]interface{}
+	start, size := 0, 0
+	for i, row := range rows {
+		rowBytes := 0
+		if maxBytes > 0 {
+			rowBytes = RowBytes(row)
+		}
+		count := i - start
+		full := (maxRows > 0 && count >= maxRows) || (maxBytes > 0 && count > 0 && size+rowBytes > maxBytes)
+		if full {
+			groups = append(groups, rows[start:i])
+			start, size = i, 0
+		}
+		size += rowBytes
+	}
+	groups = append(groups, rows[start:])
+
+	chunks := make([]Chunk, len(groups))
+	for i, group := range groups {
+		chunks[i] = Chunk{Index: i, Total: len(groups), Rows: group}
+	}
+	return chunks
+}
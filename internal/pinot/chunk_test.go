@@ -0,0 +1,45 @@
+package pinot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	row := func(value string) []interface{} { return []interface{}{value} }
+	// Each of these rows encodes to 5 bytes, e.g. ["a"]
+	a, b, c, d := row("a"), row("b"), row("c"), row("d")
+	large := row("a much larger row")
+
+	tests := []struct {
+		name     string
+		rows     [][]interface{}
+		maxRows  int
+		maxBytes int
+		want     [][][]interface{}
+	}{
+		{name: "no limits", rows: [][]interface{}{a, b, c}, want: [][][]interface{}{{a, b, c}}},
+		{name: "empty result", rows: [][]interface{}{}, maxRows: 2, want: [][][]interface{}{{}}},
+		{name: "rows", rows: [][]interface{}{a, b, c, d}, maxRows: 3, want: [][][]interface{}{{a, b, c}, {d}}},
+		{name: "rows divide evenly", rows: [][]interface{}{a, b, c, d}, maxRows: 2, want: [][][]interface{}{{a, b}, {c, d}}},
+		{name: "bytes", rows: [][]interface{}{a, b, c, d}, maxBytes: 10, want: [][][]interface{}{{a, b}, {c, d}}},
+		{name: "oversized row on its own", rows: [][]interface{}{a, large, b}, maxBytes: 10, want: [][][]interface{}{{a}, {large}, {b}}},
+		{name: "rows and bytes", rows: [][]interface{}{a, b, c, d}, maxRows: 1, maxBytes: 100, want: [][][]interface{}{{a}, {b}, {c}, {d}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(tt.rows, tt.maxRows, tt.maxBytes)
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("Split returned %d chunks, want %d", len(chunks), len(tt.want))
+			}
+			for i, chunk := range chunks {
+				if chunk.Index != i || chunk.Total != len(tt.want) {
+					t.Errorf("chunk %d is %d of %d", i, chunk.Index, chunk.Total)
+				}
+				if !reflect.DeepEqual(chunk.Rows, tt.want[i]) {
+					t.Errorf("chunk %d rows = %v, want %v", i, chunk.Rows, tt.want[i])
+				}
+			}
+		})
+	}
+}
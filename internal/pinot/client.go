@@ -0,0 +1,217 @@
+package pinot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"qstreams/internal/auth"
+	"qstreams/internal/storage"
+	"qstreams/internal/tracing"
+)
+
+// Client executes SQL queries against a Pinot broker. When Pool is set,
+// queries go to the pool's brokers instead of BrokerURL, failing over to the
+// next broker on connection errors and server errors.
+type Client struct {
+	BrokerURL string
+	HTTP      *http.Client
+	Auth      auth.Provider
+	Options   storage.QueryOptions
+	Pool      *BrokerPool
+}
+
+// StatusError is returned when the broker answers with a non-200 status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Pinot query failed with status %d", e.StatusCode)
+}
+
+func NewClient(brokerURL string, httpClient *http.Client, provider auth.Provider) *Client {
+	return &Client{BrokerURL: brokerURL, HTTP: httpClient, Auth: provider}
+}
+
+// Query runs sql on the broker and decodes the response
+func (c *Client) Query(ctx context.Context, sql string) (*BrokerResponse, error) {
+	return c.query(ctx, sql, nil)
+}
+
+// QueryCursor runs sql asking the broker to keep the result set in its
+// response store and return only the first numRows rows.
+func (c *Client) QueryCursor(ctx context.Context, sql string, numRows int) (*BrokerResponse, error) {
+	params := url.Values{}
+	params.Set("getCursor", "true")
+	params.Set("numRows", strconv.Itoa(numRows))
+	return c.query(ctx, sql, params)
+}
+
+// FetchCursor reads the next page of a cursor opened by QueryCursor on broker
+func (c *Client) FetchCursor(ctx context.Context, broker, requestID string, offset, numRows int) (*BrokerResponse, error) {
+	target := fmt.Sprintf("%s/responseStore/%s/results?offset=%d&numRows=%d",
+		broker, url.PathEscape(requestID), offset, numRows)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cursor request: %w", err)
+	}
+	return c.do(req)
+}
+
+// CloseCursor releases a cursor's result set on broker
+func (c *Client) CloseCursor(ctx context.Context, broker, requestID string) error {
+	target := fmt.Sprintf("%s/responseStore/%s", broker, url.PathEscape(requestID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create cursor delete request: %w", err)
+	}
+	if err := c.Auth.Apply(req); err != nil {
+		return fmt.Errorf("failed to authenticate Pinot request: %w", err)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete cursor: %w", err)
+	}
+	resp.Body.Close()
+	auth.Rejected(c.Auth, resp)
+	return nil
+}
+
+func (c *Client) query(ctx context.Context, sql string, params url.Values) (*BrokerResponse, error) {
+	body := map[string]interface{}{"sql": sql}
+	if options := EncodeOptions(c.Options); options != "" {
+		body["queryOptions"] = options
+	}
+	if c.Options.Trace != nil && *c.Options.Trace {
+		body["trace"] = true
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Pinot query: %w", err)
+	}
+
+	if c.Pool == nil {
+		response, err := c.post(ctx, c.BrokerURL, params, payload)
+		if err != nil {
+			return nil, err
+		}
+		response.Broker = c.baseURL()
+		return response, nil
+	}
+
+	brokers, err := c.Pool.Candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, broker := range brokers {
+		response, err := c.post(ctx, broker+"/query/sql", params, payload)
+		if err == nil {
+			c.Pool.MarkHealthy(broker)
+			response.Broker = broker
+			return response, nil
+		}
+		// Client errors and cancellation would fail the same way on every broker
+		var statusErr *StatusError
+		if ctx.Err() != nil || (errors.As(err, &statusErr) && statusErr.StatusCode < 500) {
+			return nil, err
+		}
+		c.Pool.MarkFailed(broker, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all %d brokers failed, last error: %w", len(brokers), lastErr)
+}
+
+func (c *Client) post(ctx context.Context, target string, params url.Values, payload []byte) (*BrokerResponse, error) {
+	if len(params) > 0 {
+		parsed, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker URL: %w", err)
+		}
+		query := parsed.Query()
+		for key, values := range params {
+			query[key] = values
+		}
+		parsed.RawQuery = query.Encode()
+		target = parsed.String()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pinot query request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+func (c *Client) do(req *http.Request) (*BrokerResponse, error) {
+	if err := c.Auth.Apply(req); err != nil {
+		return nil, fmt.Errorf("failed to authenticate Pinot request: %w", err)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Pinot: %w", err)
+	}
+	defer resp.Body.Close()
+	auth.Rejected(c.Auth, resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	_, decodeSpan := tracing.Start(req.Context(), "pinot.decode")
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var response BrokerResponse
+	err = decoder.Decode(&response)
+	tracing.End(decodeSpan, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Pinot response: %w", err)
+	}
+	return &response, nil
+}
+
+// Health calls the /health endpoint that Pinot brokers and controllers expose
+func (c *Client) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL()+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	if err := c.Auth.Apply(req); err != nil {
+		return fmt.Errorf("failed to authenticate Pinot request: %w", err)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("Pinot is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	auth.Rejected(c.Auth, resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Pinot health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// baseURL strips the query path from the broker URL so the response store
+// endpoints can be addressed on the same broker.
+func (c *Client) baseURL() string {
+	base := strings.TrimRight(c.BrokerURL, "/")
+	if i := strings.Index(base, "?"); i >= 0 {
+		base = base[:i]
+	}
+	for _, suffix := range []string{"/query/sql", "/query"} {
+		if strings.HasSuffix(base, suffix) {
+			return strings.TrimSuffix(base, suffix)
+		}
+	}
+	return base
+}
@@ -0,0 +1,107 @@
+package pinot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error classes reported in stream status and metrics
+const (
+	ErrorSyntax        = "syntax"
+	ErrorTableNotFound = "table_not_found"
+	ErrorAccessDenied  = "access_denied"
+	ErrorTimeout       = "timeout"
+	ErrorPartial       = "partial"
+	ErrorServer        = "server"
+	ErrorUnavailable   = "unavailable"
+)
+
+// QueryError is a query that the broker answered with exceptions, or with a
+// result assembled from only some of the servers.
+type QueryError struct {
+	Class      string
+	Code       int
+	Message    string
+	Exceptions []Exception
+}
+
+func (e *QueryError) Error() string {
+	if e.Class == ErrorPartial && e.Code == 0 {
+		return "Pinot returned a partial result"
+	}
+	return fmt.Sprintf("Pinot query failed (%s, error code %d): %s", e.Class, e.Code, e.Message)
+}
+
+// Partial reports whether the error still carries usable rows
+func (e *QueryError) Partial() bool {
+	return e.Class == ErrorPartial
+}
+
+// Classify maps a Pinot QueryException error code to an error class
+func Classify(code int) string {
+	switch code {
+	case 100, 150, 160, 700, 710, 720:
+		// JSON and SQL parsing, query validation, unknown column and planning errors
+		return ErrorSyntax
+	case 190, 191, 230, 410:
+		// Table missing or disabled on the broker or servers
+		return ErrorTableNotFound
+	case 180:
+		return ErrorAccessDenied
+	case 240, 250, 251, 400, 427:
+		// Scheduling, execution, combine and broker timeouts, and servers that did not respond
+		return ErrorTimeout
+	default:
+		return ErrorServer
+	}
+}
+
+// CheckResponse returns the error described by a broker response, or nil when
+// the query succeeded on every server. Timeouts and server errors that still
+// produced a result table are reported as partial results; parse, table and
+// access errors never are.
+func CheckResponse(response *BrokerResponse) *QueryError {
+	if len(response.Exceptions) == 0 {
+		if response.Partial() {
+			return &QueryError{Class: ErrorPartial}
+		}
+		return nil
+	}
+
+	first := response.Exceptions[0]
+	class := Classify(first.ErrorCode)
+	err := &QueryError{
+		Class:      class,
+		Code:       first.ErrorCode,
+		Message:    strings.TrimSpace(firstLine(first.Message)),
+		Exceptions: response.Exceptions,
+	}
+	if (class == ErrorTimeout || class == ErrorServer) && response.ResultTable != nil {
+		err.Class = ErrorPartial
+	}
+	return err
+}
+
+// ErrorClass returns the class of any error from querying Pinot. Errors that
+// are not broker exceptions mean the broker could not be queried at all.
+func ErrorClass(err error) string {
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return queryErr.Class
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+		return ErrorAccessDenied
+	}
+	return ErrorUnavailable
+}
+
+// firstLine drops the stack traces Pinot appends to exception messages
+func firstLine(message string) string {
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		return message[:i]
+	}
+	return message
+}
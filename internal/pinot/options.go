@@ -0,0 +1,62 @@
+package pinot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"qstreams/internal/storage"
+)
+
+// EncodeOptions renders query options in the broker's "key=value;key=value"
+// form. Keys are sorted so the request body is stable across ticks.
+func EncodeOptions(options storage.QueryOptions) string {
+	values := map[string]string{}
+	for key, value := range options.QueryOptions {
+		values[key] = value
+	}
+	if options.TimeoutMs > 0 {
+		values["timeoutMs"] = strconv.Itoa(options.TimeoutMs)
+	}
+	if options.UseMultistageEngine != nil {
+		values["useMultistageEngine"] = strconv.FormatBool(*options.UseMultistageEngine)
+	}
+	if options.MaxExecutionThreads > 0 {
+		values["maxExecutionThreads"] = strconv.Itoa(options.MaxExecutionThreads)
+	}
+	if options.EnableNullHandling != nil {
+		values["enableNullHandling"] = strconv.FormatBool(*options.EnableNullHandling)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + values[key]
+	}
+	return strings.Join(parts, ";")
+}
+
+// ValidateOptions checks that query options are in range and can be encoded
+func ValidateOptions(options storage.QueryOptions) error {
+	if options.TimeoutMs < 0 {
+		return fmt.Errorf("pinot.options.timeout_ms must not be negative")
+	}
+	if options.MaxExecutionThreads < 0 {
+		return fmt.Errorf("pinot.options.max_execution_threads must not be negative")
+	}
+	for key, value := range options.QueryOptions {
+		if key == "" || strings.TrimSpace(key) != key || strings.ContainsAny(key, "=;") {
+			return fmt.Errorf("pinot.options.query_options has an invalid option name %q", key)
+		}
+		if value == "" || strings.Contains(value, ";") {
+			return fmt.Errorf("pinot.options.query_options.%s must be non-empty and must not contain ';'", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package pinot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"qstreams/internal/storage"
+)
+
+// DefaultPageSize is used when pagination is enabled without a page size
+const DefaultPageSize = 1000
+
+// DefaultMaxRows caps offset pagination for streams saved before max_rows or
+// a LIMIT was required
+const DefaultMaxRows = 100000
+
+var limitClause = regexp.MustCompile(`(?is)\s+LIMIT\s+(\d+)(?:\s*,\s*(\d+)|\s+OFFSET\s+(\d+))?\s*;?\s*$`)
+
+// Fetch runs the stream's query and returns the complete result, paging
+// through it when pagination is enabled. With pagination, rows beyond MaxRows
+// are never fetched; without it, the whole result is fetched and truncated
+// to MaxRows.
+func Fetch(ctx context.Context, client *Client, config storage.PinotConfig) (*BrokerResponse, error) {
+	pagination := config.Pagination
+	if !pagination.Enabled {
+		response, err := client.Query(ctx, config.Query)
+		if err != nil {
+			return nil, err
+		}
+		truncate(response, pagination.MaxRows)
+		return response, nil
+	}
+
+	pageSize := pagination.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	if pagination.Mode == "cursor" {
+		return fetchCursor(ctx, client, config.Query, pageSize, pagination.MaxRows)
+	}
+	return fetchOffset(ctx, client, config.Query, pageSize, pagination.MaxRows)
+}
+
+// fetchOffset pages through the result by rewriting the query's LIMIT clause.
+// A LIMIT in the original query is kept as an upper bound on the rows fetched
+// and its offset as the first row. Pages are separate queries, so the query
+// needs an ORDER BY on a unique key for the pages to be consistent.
+func fetchOffset(ctx context.Context, client *Client, query string, pageSize, maxRows int) (*BrokerResponse, error) {
+	base, start, limit := SplitLimit(query)
+	if limit > 0 && (maxRows <= 0 || limit < maxRows) {
+		maxRows = limit
+	}
+	if maxRows <= 0 {
+		maxRows = DefaultMaxRows
+	}
+
+	var result *BrokerResponse
+	for fetched := 0; fetched < maxRows; fetched += pageSize {
+		size := pageSize
+		if fetched+size > maxRows {
+			size = maxRows - fetched
+		}
+
+		offset := start + fetched
+		page, err := client.Query(ctx, fmt.Sprintf("%s LIMIT %d OFFSET %d", base, size, offset))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch page at offset %d: %w", offset, err)
+		}
+		if len(page.Exceptions) > 0 {
+			// Keep the rows of earlier pages so a partial result can still be delivered
+			addCost(result, page)
+			result = merge(result, page)
+			result.Exceptions = page.Exceptions
+			return result, nil
+		}
+
+		addCost(result, page)
+		result = merge(result, page)
+		if len(page.Rows()) < size {
+			break
+		}
+	}
+	return result, nil
+}
+
+// fetchCursor pages through the result using the broker's response store
+func fetchCursor(ctx context.Context, client *Client, query string, pageSize, maxRows int) (*BrokerResponse, error) {
+	if maxRows > 0 && maxRows < pageSize {
+		pageSize = maxRows
+	}
+
+	first, err := client.QueryCursor(ctx, query, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if first.RequestID == "" || len(first.Exceptions) > 0 {
+		// The broker does not support cursors or the query failed
+		truncate(first, maxRows)
+		return first, nil
+	}
+	defer client.CloseCursor(context.WithoutCancel(ctx), first.Broker, first.RequestID)
+
+	result := merge(nil, first)
+	total := first.NumRowsResultSet
+	if maxRows > 0 && (total <= 0 || total > maxRows) {
+		total = maxRows
+	}
+
+	for offset := len(result.Rows()); offset < total; offset += pageSize {
+		size := pageSize
+		if offset+size > total {
+			size = total - offset
+		}
+
+		page, err := client.FetchCursor(ctx, first.Broker, first.RequestID, offset, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch cursor page at offset %d: %w", offset, err)
+		}
+		if len(page.Rows()) == 0 {
+			break
+		}
+		result = merge(result, page)
+	}
+
+	truncate(result, maxRows)
+	return result, nil
+}
+
+// SplitLimit removes a trailing LIMIT clause from query, returning the query
+// without it, the clause's offset and its row count (0 when the query has no
+// LIMIT).
+func SplitLimit(query string) (string, int, int) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	match := limitClause.FindStringSubmatch(query)
+	if match == nil {
+		return query, 0, 0
+	}
+
+	base := strings.TrimSpace(query[:len(query)-len(match[0])])
+	offset := 0
+	count, _ := strconv.Atoi(match[1])
+	switch {
+	case match[2] != "":
+		// "LIMIT offset, count" form
+		offset = count
+		count, _ = strconv.Atoi(match[2])
+	case match[3] != "":
+		// "LIMIT count OFFSET offset" form
+		offset, _ = strconv.Atoi(match[3])
+	}
+	return base, offset, count
+}
+
+func merge(result, page *BrokerResponse) *BrokerResponse {
+	if result == nil {
+		copied := *page
+		if page.ResultTable != nil {
+			table := *page.ResultTable
+			copied.ResultTable = &table
+		}
+		return &copied
+	}
+	if page.Partial() {
+		result.PartialResult = true
+	}
+	if page.ResultTable == nil {
+		return result
+	}
+	if result.ResultTable == nil {
+		table := *page.ResultTable
+		result.ResultTable = &table
+		return result
+	}
+	result.ResultTable.Rows = append(result.ResultTable.Rows, page.ResultTable.Rows...)
+	return result
+}
+
+// addCost adds the execution statistics of an offset page to the result.
+// Each offset page is a separate query; cursor pages are not, and repeat the
+// statistics of the query that opened the cursor.
+func addCost(result, page *BrokerResponse) {
+	if result == nil {
+		return
+	}
+	result.TimeUsedMs += page.TimeUsedMs
+	result.NumDocsScanned += page.NumDocsScanned
+	result.NumEntriesScannedInFilter += page.NumEntriesScannedInFilter
+	result.NumEntriesScannedPostFilter += page.NumEntriesScannedPostFilter
+	result.NumSegmentsQueried += page.NumSegmentsQueried
+	result.NumSegmentsProcessed += page.NumSegmentsProcessed
+	result.NumSegmentsMatched += page.NumSegmentsMatched
+}
+
+func truncate(response *BrokerResponse, maxRows int) {
+	if maxRows > 0 && response.ResultTable != nil && len(response.ResultTable.Rows) > maxRows {
+		response.ResultTable.Rows = response.ResultTable.Rows[:maxRows]
+	}
+}
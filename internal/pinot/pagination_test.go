@@ -0,0 +1,123 @@
+package pinot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"qstreams/internal/auth"
+	"qstreams/internal/storage"
+)
+
+var pageClause = regexp.MustCompile(`LIMIT (\d+) OFFSET (\d+)$`)
+
+// tableBroker serves a table of n rows holding their own index, answering
+// the LIMIT/OFFSET queries written by fetchOffset
+func tableBroker(t *testing.T, n int) (*Client, *[]string) {
+	t.Helper()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SQL string `json:"sql"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		queries = append(queries, body.SQL)
+
+		match := pageClause.FindStringSubmatch(body.SQL)
+		if match == nil {
+			t.Errorf("query without a page clause: %s", body.SQL)
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(match[1])
+		offset, _ := strconv.Atoi(match[2])
+		rows := [][]interface{}{}
+		for i := offset; i < offset+limit && i < n; i++ {
+			rows = append(rows, []interface{}{i})
+		}
+		json.NewEncoder(w).Encode(BrokerResponse{ResultTable: &ResultTable{
+			DataSchema: DataSchema{ColumnNames: []string{"id"}, ColumnDataTypes: []string{"INT"}},
+			Rows:       rows,
+		}})
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := auth.NewProvider(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return NewClient(server.URL+"/query/sql", server.Client(), provider), &queries
+}
+
+func TestFetchOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    int
+		query    string
+		pageSize int
+		maxRows  int
+		first    int
+		rows     int
+		queries  int
+	}{
+		{name: "max_rows", table: 100, query: "SELECT id FROM t ORDER BY id", pageSize: 10, maxRows: 25, rows: 25, queries: 3},
+		{name: "limit", table: 100, query: "SELECT id FROM t ORDER BY id LIMIT 15", pageSize: 10, rows: 15, queries: 2},
+		{name: "limit below max_rows", table: 100, query: "SELECT id FROM t ORDER BY id LIMIT 15", pageSize: 10, maxRows: 50, rows: 15, queries: 2},
+		{name: "limit with offset", table: 100, query: "SELECT id FROM t ORDER BY id LIMIT 5 OFFSET 10", pageSize: 2, first: 10, rows: 5, queries: 3},
+		{name: "limit offset, count", table: 100, query: "SELECT id FROM t ORDER BY id LIMIT 10, 5;", pageSize: 10, first: 10, rows: 5, queries: 1},
+		{name: "short last page", table: 23, query: "SELECT id FROM t ORDER BY id", pageSize: 10, maxRows: 50, rows: 23, queries: 3},
+		{name: "unbounded query is capped", table: DefaultMaxRows + 10, query: "SELECT id FROM t ORDER BY id", pageSize: DefaultMaxRows / 4, rows: DefaultMaxRows, queries: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, queries := tableBroker(t, tt.table)
+			config := storage.PinotConfig{Query: tt.query, Pagination: storage.PaginationConfig{
+				Enabled:  true,
+				PageSize: tt.pageSize,
+				MaxRows:  tt.maxRows,
+			}}
+			response, err := Fetch(context.Background(), client, config)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			rows := response.Rows()
+			if len(rows) != tt.rows {
+				t.Fatalf("Fetch returned %d rows, want %d", len(rows), tt.rows)
+			}
+			for i, row := range rows {
+				if got := fmt.Sprint(row[0]); got != strconv.Itoa(tt.first+i) {
+					t.Fatalf("row %d is %s, want %d", i, got, tt.first+i)
+				}
+			}
+			if len(*queries) != tt.queries {
+				t.Errorf("Fetch ran %d queries, want %d: %v", len(*queries), tt.queries, *queries)
+			}
+		})
+	}
+}
+
+func TestSplitLimit(t *testing.T) {
+	tests := []struct {
+		query  string
+		base   string
+		offset int
+		count  int
+	}{
+		{"SELECT * FROM t", "SELECT * FROM t", 0, 0},
+		{"SELECT * FROM t LIMIT 10", "SELECT * FROM t", 0, 10},
+		{"SELECT * FROM t limit 10 offset 20;", "SELECT * FROM t", 20, 10},
+		{"SELECT * FROM t LIMIT 20, 10", "SELECT * FROM t", 20, 10},
+		{"SELECT * FROM (SELECT * FROM t LIMIT 5) ORDER BY id", "SELECT * FROM (SELECT * FROM t LIMIT 5) ORDER BY id", 0, 0},
+	}
+	for _, tt := range tests {
+		base, offset, count := SplitLimit(tt.query)
+		if base != tt.base || offset != tt.offset || count != tt.count {
+			t.Errorf("SplitLimit(%q) = %q, %d, %d, want %q, %d, %d", tt.query, base, offset, count, tt.base, tt.offset, tt.count)
+		}
+	}
+}
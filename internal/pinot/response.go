@@ -0,0 +1,73 @@
+package pinot
+
+import "encoding/json"
+
+// BrokerResponse is the subset of a Pinot broker response used by qstreams.
+// Numbers in result rows are decoded as json.Number so that LONG and BIG_DECIMAL
+// values survive re-encoding without losing precision.
+type BrokerResponse struct {
+	ResultTable *ResultTable `json:"resultTable,omitempty"`
+	Exceptions  []Exception  `json:"exceptions,omitempty"`
+
+	// Set when some servers did not contribute to the result
+	PartialResult       bool `json:"partialResult,omitempty"`
+	NumServersQueried   int  `json:"numServersQueried,omitempty"`
+	NumServersResponded int  `json:"numServersResponded,omitempty"`
+
+	// Execution statistics
+	TimeUsedMs                  int64 `json:"timeUsedMs,omitempty"`
+	NumDocsScanned              int64 `json:"numDocsScanned,omitempty"`
+	NumEntriesScannedInFilter   int64 `json:"numEntriesScannedInFilter,omitempty"`
+	NumEntriesScannedPostFilter int64 `json:"numEntriesScannedPostFilter,omitempty"`
+	NumSegmentsQueried          int64 `json:"numSegmentsQueried,omitempty"`
+	NumSegmentsProcessed        int64 `json:"numSegmentsProcessed,omitempty"`
+	NumSegmentsMatched          int64 `json:"numSegmentsMatched,omitempty"`
+	TotalDocs                   int64 `json:"totalDocs,omitempty"`
+
+	// Cursor responses (Pinot 1.3+) carry the request id and paging position
+	RequestID        string `json:"requestId,omitempty"`
+	Offset           int    `json:"offset,omitempty"`
+	NumRows          int    `json:"numRows,omitempty"`
+	NumRowsResultSet int    `json:"numRowsResultSet,omitempty"`
+
+	// Broker is the base URL of the broker that answered, used to reach its
+	// response store for cursor pages
+	Broker string `json:"-"`
+}
+
+type ResultTable struct {
+	DataSchema DataSchema      `json:"dataSchema"`
+	Rows       [][]interface{} `json:"rows"`
+}
+
+type DataSchema struct {
+	ColumnNames     []string `json:"columnNames"`
+	ColumnDataTypes []string `json:"columnDataTypes"`
+}
+
+type Exception struct {
+	ErrorCode int    `json:"errorCode"`
+	Message   string `json:"message"`
+}
+
+// Partial reports whether the broker flagged the result as incomplete
+func (r *BrokerResponse) Partial() bool {
+	return r.PartialResult || r.NumServersResponded < r.NumServersQueried
+}
+
+// Rows returns the result rows, or nil when the response has no result table
+func (r *BrokerResponse) Rows() [][]interface{} {
+	if r.ResultTable == nil {
+		return nil
+	}
+	return r.ResultTable.Rows
+}
+
+// RowBytes estimates the encoded size of a row, used when chunking by bytes
+func RowBytes(row []interface{}) int {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
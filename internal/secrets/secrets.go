@@ -0,0 +1,303 @@
+// Package secrets encrypts credentials stored on disk and resolves external
+// secret references.
+//
+// Values are sealed with AES-256-GCM using the key in QSTREAMS_SECRET_KEY or
+// the file named by QSTREAMS_SECRET_KEY_FILE (32 bytes, base64 encoded), or
+// the equivalent secrets settings passed to Configure. When no key is
+// configured values are stored as given.
+//
+// A value may instead reference a secret held elsewhere, alone or inside a
+// larger string such as "Bearer ${env:QSTREAMS_REF_PINOT_TOKEN}":
+//
+//	${env:NAME}   the environment variable NAME
+//	${file:/path} the contents of /path, without trailing newlines
+//
+// Streams are written by API callers and sent to URLs they choose, so only
+// variables named with ReferenceEnvPrefix and files inside the directory set
+// with ConfigureReferences may be referenced; without that directory file
+// references are refused. The server's own secret key never resolves.
+//
+// References are only resolved when a request is made, so rotating the
+// variable or file takes effect without editing streams. A value made up of
+// references alone is stored and displayed as written; one that also holds
+// literal text, such as the example above, is encrypted and redacted whole
+// since that text may itself be secret.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// Redacted replaces secret values in API responses. Sending it back in an
+	// update keeps the stored value.
+	Redacted = "********"
+
+	// ReferenceEnvPrefix starts the name of every environment variable a
+	// ${env:...} reference may read
+	ReferenceEnvPrefix = "QSTREAMS_REF_"
+
+	sealedPrefix = "enc:v1:"
+)
+
+var ErrNoKey = errors.New("secrets: value is encrypted but no secret key is configured")
+
+var reference = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+var key struct {
+	sync.Once
+	aead cipher.AEAD
+	err  error
+
+	// encoded and file replace the environment variables when set by Configure
+	encoded string
+	file    string
+}
+
+// referenceDir is the directory ${file:...} references may read from
+var referenceDir string
+
+// Configure sets the key, or the file holding it, in place of the
+// environment. It must be called before LoadKey.
+func Configure(encoded, file string) {
+	key.encoded = encoded
+	key.file = file
+}
+
+// ConfigureReferences sets the directory ${file:...} references and token
+// files may read from. When dir is empty file references are refused.
+func ConfigureReferences(dir string) error {
+	if dir == "" {
+		referenceDir = ""
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err == nil {
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return fmt.Errorf("secrets: invalid reference directory: %w", err)
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return fmt.Errorf("secrets: reference directory %s is not a directory", dir)
+	}
+	referenceDir = abs
+	return nil
+}
+
+// LoadKey reads the encryption key from the configuration or the
+// environment. It returns an error only when a key is configured but invalid.
+func LoadKey() error {
+	key.Do(func() {
+		key.aead, key.err = loadKey()
+	})
+	return key.err
+}
+
+// Enabled reports whether values are encrypted at rest
+func Enabled() bool {
+	return LoadKey() == nil && key.aead != nil
+}
+
+func loadKey() (cipher.AEAD, error) {
+	encoded, path := key.encoded, key.file
+	if encoded == "" && path == "" {
+		encoded, path = os.Getenv("QSTREAMS_SECRET_KEY"), os.Getenv("QSTREAMS_SECRET_KEY_FILE")
+	}
+	if encoded == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: failed to read key file: %w", err)
+		}
+		encoded = string(data)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		raw, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("secrets: key must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals value for storage. Empty values, values made up only of
+// references and values that are already sealed are returned unchanged, as is
+// everything when no key is configured.
+func Encrypt(value string) (string, error) {
+	if value == "" || IsSealed(value) || IsReference(value) {
+		return value, nil
+	}
+	if err := LoadKey(); err != nil {
+		return "", err
+	}
+	if key.aead == nil {
+		return value, nil
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("secrets: failed to generate nonce: %w", err)
+	}
+	sealed := key.aead.Seal(nonce, nonce, []byte(value), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt. Other values are returned unchanged.
+func Decrypt(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if err := LoadKey(); err != nil {
+		return "", err
+	}
+	if key.aead == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return "", fmt.Errorf("secrets: malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	plaintext, err := key.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("secrets: failed to decrypt value, is the key correct?")
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether value was produced by Encrypt
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// IsReference reports whether value is made up only of secret references and
+// whitespace
+func IsReference(value string) bool {
+	return reference.MatchString(value) && strings.TrimSpace(reference.ReplaceAllString(value, "")) == ""
+}
+
+// CheckReferences returns an error if value references a variable or file
+// that Resolve refuses to read
+func CheckReferences(value string) error {
+	for _, parts := range reference.FindAllStringSubmatch(value, -1) {
+		if parts[1] == "env" {
+			if err := checkEnv(parts[2]); err != nil {
+				return err
+			}
+		} else if _, err := CheckFile(parts[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkEnv(name string) error {
+	if !strings.HasPrefix(name, ReferenceEnvPrefix) || name == "QSTREAMS_SECRET_KEY" || name == "QSTREAMS_SECRET_KEY_FILE" {
+		return fmt.Errorf("secrets: environment variable %s cannot be referenced, only %s* variables can", name, ReferenceEnvPrefix)
+	}
+	return nil
+}
+
+// CheckFile returns the path of a secret file after following symlinks, or an
+// error if it lies outside the reference directory or holds the secret key.
+// Relative paths are taken from the reference directory.
+func CheckFile(path string) (string, error) {
+	if referenceDir == "" {
+		return "", fmt.Errorf("secrets: file %s cannot be referenced, no secrets reference directory is configured", path)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(referenceDir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("secrets: failed to resolve secret file: %w", err)
+	}
+	rel, err := filepath.Rel(referenceDir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("secrets: file %s is outside the secrets reference directory", path)
+	}
+	for _, keyFile := range []string{key.file, os.Getenv("QSTREAMS_SECRET_KEY_FILE")} {
+		if keyFile == "" {
+			continue
+		}
+		if keyPath, err := filepath.EvalSymlinks(keyFile); err == nil && keyPath == resolved {
+			return "", fmt.Errorf("secrets: file %s holds the secret key and cannot be referenced", path)
+		}
+	}
+	return resolved, nil
+}
+
+// Resolve replaces every secret reference in value with the secret it names
+func Resolve(value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var resolveErr error
+	fail := func(err error) {
+		if resolveErr == nil {
+			resolveErr = err
+		}
+	}
+	resolved := reference.ReplaceAllStringFunc(value, func(match string) string {
+		parts := reference.FindStringSubmatch(match)
+		switch parts[1] {
+		case "env":
+			if err := checkEnv(parts[2]); err != nil {
+				fail(err)
+				return ""
+			}
+			secret, ok := os.LookupEnv(parts[2])
+			if !ok {
+				fail(fmt.Errorf("secrets: environment variable %s is not set", parts[2]))
+			}
+			return secret
+		default:
+			path, err := CheckFile(parts[2])
+			if err != nil {
+				fail(err)
+				return ""
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				fail(fmt.Errorf("secrets: failed to read secret file: %w", err))
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return resolved, nil
+}
+
+// Redact hides a secret for display. References name where a secret lives
+// rather than the secret itself, so a value made up only of references is
+// shown as written.
+func Redact(value string) string {
+	if value == "" || IsReference(value) {
+		return value
+	}
+	return Redacted
+}
@@ -0,0 +1,124 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The key is loaded once per process, so every test shares this one
+	Configure(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")), "")
+	os.Exit(m.Run())
+}
+
+func TestEncryptAndRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		keep  bool
+	}{
+		{name: "empty", value: "", keep: true},
+		{name: "env reference", value: "${env:QSTREAMS_REF_TOKEN}", keep: true},
+		{name: "file reference", value: "${file:token}", keep: true},
+		{name: "references and whitespace", value: " ${env:QSTREAMS_REF_USER} ${file:token}\n", keep: true},
+		{name: "plain secret", value: "s3cr3t"},
+		{name: "reference with a literal prefix", value: "Bearer ${env:QSTREAMS_REF_TOKEN}"},
+		{name: "secret next to a reference", value: "${env:QSTREAMS_REF_USER}:hunter2"},
+		{name: "unterminated reference", value: "${env:QSTREAMS_REF_TOKEN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := Encrypt(tt.value)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			redacted := Redact(tt.value)
+			if tt.keep {
+				if sealed != tt.value || redacted != tt.value {
+					t.Errorf("Encrypt = %q, Redact = %q, want both unchanged", sealed, redacted)
+				}
+				return
+			}
+
+			if !IsSealed(sealed) || strings.Contains(sealed, tt.value) {
+				t.Errorf("Encrypt = %q, want a sealed value", sealed)
+			}
+			if redacted != Redacted {
+				t.Errorf("Redact = %q, want %q", redacted, Redacted)
+			}
+			opened, err := Decrypt(sealed)
+			if err != nil || opened != tt.value {
+				t.Errorf("Decrypt = %q, %v, want %q", opened, err, tt.value)
+			}
+			if again, _ := Encrypt(sealed); again != sealed {
+				t.Errorf("Encrypt of a sealed value changed it")
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "outside")
+	if err := os.WriteFile(outside, []byte("outside"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfigureReferences(dir); err != nil {
+		t.Fatalf("ConfigureReferences: %v", err)
+	}
+	defer ConfigureReferences("")
+	t.Setenv("QSTREAMS_REF_TOKEN", "from-env")
+	t.Setenv("OTHER_TOKEN", "not allowed")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", value: "plain", want: "plain"},
+		{name: "env", value: "${env:QSTREAMS_REF_TOKEN}", want: "from-env"},
+		{name: "env inside text", value: "Bearer ${env:QSTREAMS_REF_TOKEN}", want: "Bearer from-env"},
+		{name: "relative file", value: "${file:token}", want: "from-file"},
+		{name: "absolute file", value: "${file:" + filepath.Join(dir, "token") + "}", want: "from-file"},
+		{name: "two references", value: "${env:QSTREAMS_REF_TOKEN}:${file:token}", want: "from-env:from-file"},
+		{name: "unset env", value: "${env:QSTREAMS_REF_MISSING}", wantErr: true},
+		{name: "env without prefix", value: "${env:OTHER_TOKEN}", wantErr: true},
+		{name: "secret key env", value: "${env:QSTREAMS_SECRET_KEY}", wantErr: true},
+		{name: "file outside directory", value: "${file:" + outside + "}", wantErr: true},
+		{name: "relative escape", value: "${file:../outside}", wantErr: true},
+		{name: "symlink out of directory", value: "${file:link}", wantErr: true},
+		{name: "missing file", value: "${file:missing}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileReferencesNeedDirectory(t *testing.T) {
+	ConfigureReferences("")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve("${file:" + path + "}"); err == nil {
+		t.Errorf("Resolve read a file without a reference directory")
+	}
+}
@@ -0,0 +1,43 @@
+package status
+
+import (
+	"sync"
+	"time"
+
+	"qstreams/internal/models"
+)
+
+var Cache = struct {
+	sync.Mutex
+	Data map[string]models.StreamStatus
+}{
+	Data: make(map[string]models.StreamStatus),
+}
+
+// Update applies fn to the status of a stream under the cache lock
+func Update(streamID string, fn func(*models.StreamStatus)) {
+	Cache.Lock()
+	defer Cache.Unlock()
+
+	current := Cache.Data[streamID]
+	current.StreamID = streamID
+	fn(&current)
+	current.UpdatedAt = time.Now()
+	Cache.Data[streamID] = current
+}
+
+// Get returns the status of a stream
+func Get(streamID string) (models.StreamStatus, bool) {
+	Cache.Lock()
+	defer Cache.Unlock()
+
+	current, ok := Cache.Data[streamID]
+	return current, ok
+}
+
+// Delete removes the status of a deleted stream
+func Delete(streamID string) {
+	Cache.Lock()
+	defer Cache.Unlock()
+	delete(Cache.Data, streamID)
+}
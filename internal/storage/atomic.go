@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// corruptFileError reports a state file whose contents cannot be decoded, as
+// opposed to one that cannot be read
+type corruptFileError struct {
+	Path string
+	Err  error
+}
+
+func (e *corruptFileError) Error() string {
+	return fmt.Sprintf("corrupt file %s: %v", filepath.Base(e.Path), e.Err)
+}
+
+func (e *corruptFileError) Unwrap() error {
+	return e.Err
+}
+
+// writeFileAtomic replaces path with data so that readers, and the file after
+// a crash, see either the old or the new contents. The data is written to a
+// temp file in the same directory, synced, and renamed over path.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+	// Persist the rename itself
+	return syncDir(dir)
+}
+
+// tempSuffix marks in-flight writes; leftovers from a crash are removed when
+// the store is opened
+const tempSuffix = ".tmp"
+
+func writeJSON(path string, value interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(value); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+func readJSON(path string, value interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &corruptFileError{Path: path, Err: io.ErrUnexpectedEOF}
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return &corruptFileError{Path: path, Err: err}
+	}
+	return nil
+}
+
+func isCorrupt(err error) bool {
+	var corrupt *corruptFileError
+	return errors.As(err, &corrupt)
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"qstreams/internal/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	streamsBucket     = []byte("streams")
+	connectionsBucket = []byte("connections")
+	metricsBucket     = []byte("metrics")
+	historyBucket     = []byte("history")
+	dedupeBucket      = []byte("dedupe")
+	sequencesBucket   = []byte("sequences")
+	deliveriesBucket  = []byte("deliveries")
+)
+
+// BoltStore keeps all state in a single bbolt database file. Each object is
+// a JSON value in a bucket per kind; delivery logs are nested buckets keyed
+// by a per-stream sequence.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates the database at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("bolt store %s is in use by another process", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{streamsBucket, connectionsBucket, metricsBucket, historyBucket, dedupeBucket, sequencesBucket, deliveriesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise bolt store: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) put(bucket []byte, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+// get decodes the value stored under key, returning os.ErrNotExist when there is none
+func (s *BoltStore) get(bucket []byte, key string, value interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return os.ErrNotExist
+		}
+		return json.Unmarshal(data, value)
+	})
+}
+
+func (s *BoltStore) remove(bucket []byte, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) SaveStream(stream *QueryStream) error {
+	if err := s.put(streamsBucket, stream.StreamID, stream); err != nil {
+		return fmt.Errorf("failed to save stream: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) LoadStream(streamID string) (*QueryStream, error) {
+	var stream QueryStream
+	if err := s.get(streamsBucket, streamID, &stream); err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+func (s *BoltStore) ListStreams() ([]QueryStream, error) {
+	streams := []QueryStream{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(streamsBucket).ForEach(func(key, data []byte) error {
+			var stream QueryStream
+			if err := json.Unmarshal(data, &stream); err != nil {
+				slog.Warn("Skipping invalid stream record", "key", string(key), "error", err)
+				return nil
+			}
+			streams = append(streams, stream)
+			return nil
+		})
+	})
+	return streams, err
+}
+
+func (s *BoltStore) DeleteStream(streamID string) error {
+	if _, err := s.LoadStream(streamID); err != nil {
+		return err
+	}
+	return s.remove(streamsBucket, streamID)
+}
+
+func (s *BoltStore) SaveConnection(connection *Connection) error {
+	if err := s.put(connectionsBucket, connection.Name, connection); err != nil {
+		return fmt.Errorf("failed to save connection: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) LoadConnection(name string) (*Connection, error) {
+	var connection Connection
+	if err := s.get(connectionsBucket, name, &connection); err != nil {
+		return nil, err
+	}
+	return &connection, nil
+}
+
+func (s *BoltStore) ListConnections() ([]Connection, error) {
+	connections := []Connection{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(connectionsBucket).ForEach(func(key, data []byte) error {
+			var connection Connection
+			if err := json.Unmarshal(data, &connection); err != nil {
+				slog.Warn("Skipping invalid connection record", "key", string(key), "error", err)
+				return nil
+			}
+			connections = append(connections, connection)
+			return nil
+		})
+	})
+	return connections, err
+}
+
+func (s *BoltStore) DeleteConnection(name string) error {
+	if _, err := s.LoadConnection(name); err != nil {
+		return err
+	}
+	return s.remove(connectionsBucket, name)
+}
+
+func (s *BoltStore) LoadAllMetrics() (map[string]models.StreamMetrics, error) {
+	metrics := make(map[string]models.StreamMetrics)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metricsBucket).ForEach(func(key, data []byte) error {
+			var streamMetrics models.StreamMetrics
+			if err := json.Unmarshal(data, &streamMetrics); err != nil {
+				return nil
+			}
+			metrics[string(key)] = streamMetrics
+			return nil
+		})
+	})
+	return metrics, err
+}
+
+// SaveAllMetrics writes every stream's metrics in a single transaction
+func (s *BoltStore) SaveAllMetrics(metrics map[string]models.StreamMetrics) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket)
+		for streamID, streamMetrics := range metrics {
+			data, err := json.Marshal(streamMetrics)
+			if err != nil {
+				return fmt.Errorf("failed to write metrics for stream '%s': %w", streamID, err)
+			}
+			if err := bucket.Put([]byte(streamID), data); err != nil {
+				return fmt.Errorf("failed to write metrics for stream '%s': %w", streamID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) DeleteMetrics(streamID string) error {
+	return s.remove(metricsBucket, streamID)
+}
+
+func (s *BoltStore) SaveMetricsHistory(streamID string, history models.MetricsHistory) error {
+	return s.put(historyBucket, streamID, history)
+}
+
+func (s *BoltStore) LoadMetricsHistory(streamID string) (models.MetricsHistory, bool, error) {
+	var history models.MetricsHistory
+	err := s.get(historyBucket, streamID, &history)
+	if os.IsNotExist(err) {
+		return history, false, nil
+	}
+	if err != nil {
+		return history, false, err
+	}
+	return history, true, nil
+}
+
+func (s *BoltStore) DeleteMetricsHistory(streamID string) error {
+	return s.remove(historyBucket, streamID)
+}
+
+func (s *BoltStore) SaveDedupeState(streamID string, state models.DedupeState) error {
+	return s.put(dedupeBucket, streamID, state)
+}
+
+func (s *BoltStore) LoadDedupeState(streamID string) (models.DedupeState, bool, error) {
+	var state models.DedupeState
+	err := s.get(dedupeBucket, streamID, &state)
+	if os.IsNotExist(err) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	return state, true, nil
+}
+
+func (s *BoltStore) DeleteDedupeState(streamID string) error {
+	return s.remove(dedupeBucket, streamID)
+}
+
+func (s *BoltStore) SaveEventSequence(streamID string, sequence int64) error {
+	return s.put(sequencesBucket, streamID, sequence)
+}
+
+func (s *BoltStore) LoadEventSequence(streamID string) (int64, bool, error) {
+	var sequence int64
+	err := s.get(sequencesBucket, streamID, &sequence)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return sequence, true, nil
+}
+
+func (s *BoltStore) DeleteEventSequence(streamID string) error {
+	return s.remove(sequencesBucket, streamID)
+}
+
+// AppendDelivery adds a record and drops the oldest beyond MaxDeliveries
+func (s *BoltStore) AppendDelivery(streamID string, record models.DeliveryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(deliveriesBucket).CreateBucketIfNotExists([]byte(streamID))
+		if err != nil {
+			return err
+		}
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(sequenceKey(sequence), data); err != nil {
+			return err
+		}
+
+		cursor := bucket.Cursor()
+		for excess := bucket.Stats().KeyN + 1 - MaxDeliveries; excess > 0; excess-- {
+			key, _ := cursor.First()
+			if key == nil {
+				break
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) ListDeliveries(streamID string, limit int) ([]models.DeliveryRecord, error) {
+	records := []models.DeliveryRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deliveriesBucket).Bucket([]byte(streamID))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for key, data := cursor.Last(); key != nil && (limit <= 0 || len(records) < limit); key, data = cursor.Prev() {
+			var record models.DeliveryRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				continue
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
+
+func (s *BoltStore) DeleteDeliveries(streamID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(deliveriesBucket).DeleteBucket([]byte(streamID))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func sequenceKey(sequence uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	return key
+}
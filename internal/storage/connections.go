@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+
+	"qstreams/internal/secrets"
+)
+
+// SaveConnection writes a connection profile to the state store
+func SaveConnection(connection *Connection) error {
+	sealed, err := transformConnection(*connection, secrets.Encrypt)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt connection secrets: %w", err)
+	}
+	return Current().SaveConnection(&sealed)
+}
+
+// LoadConnection reads a connection profile by name
+func LoadConnection(name string) (*Connection, error) {
+	connection, err := Current().LoadConnection(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load connection: %w", err)
+	}
+
+	opened, err := transformConnection(*connection, secrets.Decrypt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt connection secrets: %w", err)
+	}
+	return &opened, nil
+}
+
+// ListConnections reads all connection profiles
+func ListConnections() ([]Connection, error) {
+	stored, err := Current().ListConnections()
+	if err != nil {
+		return nil, err
+	}
+
+	connections := []Connection{}
+	for _, connection := range stored {
+		opened, err := transformConnection(connection, secrets.Decrypt)
+		if err != nil {
+			slog.Warn("Skipping invalid connection", "connection", connection.Name, "error", err)
+			continue
+		}
+		connections = append(connections, opened)
+	}
+	return connections, nil
+}
+
+// DeleteConnection removes a connection profile by name
+func DeleteConnection(name string) error {
+	return Current().DeleteConnection(name)
+}
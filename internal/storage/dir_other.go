@@ -0,0 +1,34 @@
+//go:build !unix
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockDir creates the lock file exclusively, failing if it exists. Unlike
+// flock the file outlives a crashed process and must then be removed by hand.
+func lockDir(dir string) (*os.File, error) {
+	path := filepath.Join(dir, lockFile)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("state directory %s is in use by another process (remove %s if it is not)", dir, path)
+		}
+		return nil, err
+	}
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	return file, nil
+}
+
+func unlockDir(file *os.File) error {
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// syncDir is a no-op where directories cannot be synced
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qstreams/internal/models"
+)
+
+// FileStore keeps one JSON file per object under Dir, in the streams,
+// connections, metrics, history and dedupe directories, and an NDJSON delivery log
+// per stream under deliveries. Files are replaced atomically, and files that
+// cannot be decoded are moved to the quarantine directory.
+type FileStore struct {
+	Dir string
+
+	// mu serialises delivery log appends and trims
+	mu      sync.Mutex
+	appends map[string]int
+
+	lock *os.File
+}
+
+// stateKinds are the directories holding one JSON file per object
+var stateKinds = []string{"streams", "connections", "metrics", "history", "dedupe", "sequences"}
+
+const (
+	lockFile            = ".qstreams.lock"
+	quarantineDirectory = "quarantine"
+)
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir, appends: make(map[string]int)}
+}
+
+// OpenFileStore locks dir against use by other processes and removes temp
+// files left behind by interrupted writes
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock state directory: %w", err)
+	}
+
+	for _, kind := range append(stateKinds, "deliveries") {
+		temps, _ := filepath.Glob(filepath.Join(dir, kind, ".*"+tempSuffix))
+		for _, temp := range temps {
+			slog.Warn("Removing incomplete write", "path", temp)
+			os.Remove(temp)
+		}
+	}
+
+	store := NewFileStore(dir)
+	store.lock = lock
+	return store, nil
+}
+
+func (s *FileStore) path(kind, name, ext string) string {
+	return filepath.Join(s.Dir, kind, name+ext)
+}
+
+// read decodes a state file, quarantining it if it is corrupt
+func (s *FileStore) read(kind, name string, value interface{}) error {
+	err := readJSON(s.path(kind, name, ".json"), value)
+	if isCorrupt(err) {
+		s.quarantine(kind, name, err)
+	}
+	return err
+}
+
+// quarantine moves a corrupt file aside, with the decode error next to it
+func (s *FileStore) quarantine(kind, name string, cause error) {
+	source := s.path(kind, name, ".json")
+	target := filepath.Join(s.Dir, quarantineDirectory, kind, fmt.Sprintf("%s.%d.json", name, time.Now().UnixNano()))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		slog.Error("Failed to quarantine corrupt file", "path", source, "error", err)
+		return
+	}
+	if err := os.Rename(source, target); err != nil {
+		slog.Error("Failed to quarantine corrupt file", "path", source, "error", err)
+		return
+	}
+	os.WriteFile(target+".error", []byte(cause.Error()+"\n"), 0644)
+	slog.Warn("Quarantined corrupt file", "path", source, "quarantined_as", target, "error", cause)
+}
+
+// Quarantined lists the files moved aside because they could not be decoded
+func (s *FileStore) Quarantined() ([]models.QuarantinedFile, error) {
+	files := []models.QuarantinedFile{}
+	for _, kind := range stateKinds {
+		dir := filepath.Join(s.Dir, quarantineDirectory, kind)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			// Names are <name>.<unix nanos>.json
+			base := strings.TrimSuffix(entry.Name(), ".json")
+			name := base
+			at := info.ModTime()
+			if i := strings.LastIndex(base, "."); i >= 0 {
+				name = base[:i]
+				var nanos int64
+				if _, err := fmt.Sscan(base[i+1:], &nanos); err == nil {
+					at = time.Unix(0, nanos)
+				}
+			}
+			file := models.QuarantinedFile{Kind: kind, Name: name, Path: path, Size: info.Size(), QuarantinedAt: at}
+			if cause, err := os.ReadFile(path + ".error"); err == nil {
+				file.Error = strings.TrimSpace(string(cause))
+			}
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].QuarantinedAt.After(files[j].QuarantinedAt)
+	})
+	return files, nil
+}
+
+func (s *FileStore) SaveStream(stream *QueryStream) error {
+	if err := writeJSON(s.path("streams", stream.StreamID, ".json"), stream); err != nil {
+		return fmt.Errorf("failed to save stream: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) LoadStream(streamID string) (*QueryStream, error) {
+	var stream QueryStream
+	if err := s.read("streams", streamID, &stream); err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+func (s *FileStore) ListStreams() ([]QueryStream, error) {
+	names, err := s.list("streams", ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	streams := []QueryStream{}
+	for _, name := range names {
+		stream, err := s.LoadStream(name)
+		if err != nil {
+			slog.Warn("Skipping invalid stream file", "path", s.path("streams", name, ".json"), "error", err)
+			continue
+		}
+		streams = append(streams, *stream)
+	}
+	return streams, nil
+}
+
+func (s *FileStore) DeleteStream(streamID string) error {
+	return os.Remove(s.path("streams", streamID, ".json"))
+}
+
+func (s *FileStore) SaveConnection(connection *Connection) error {
+	if err := writeJSON(s.path("connections", connection.Name, ".json"), connection); err != nil {
+		return fmt.Errorf("failed to save connection: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) LoadConnection(name string) (*Connection, error) {
+	var connection Connection
+	if err := s.read("connections", name, &connection); err != nil {
+		return nil, err
+	}
+	return &connection, nil
+}
+
+func (s *FileStore) ListConnections() ([]Connection, error) {
+	names, err := s.list("connections", ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	connections := []Connection{}
+	for _, name := range names {
+		connection, err := s.LoadConnection(name)
+		if err != nil {
+			slog.Warn("Skipping invalid connection file", "path", s.path("connections", name, ".json"), "error", err)
+			continue
+		}
+		connections = append(connections, *connection)
+	}
+	return connections, nil
+}
+
+func (s *FileStore) DeleteConnection(name string) error {
+	return os.Remove(s.path("connections", name, ".json"))
+}
+
+func (s *FileStore) LoadAllMetrics() (map[string]models.StreamMetrics, error) {
+	names, err := s.list("metrics", ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[string]models.StreamMetrics)
+	for _, name := range names {
+		var streamMetrics models.StreamMetrics
+		if err := s.read("metrics", name, &streamMetrics); err != nil {
+			continue
+		}
+		metrics[name] = streamMetrics
+	}
+	return metrics, nil
+}
+
+func (s *FileStore) SaveAllMetrics(metrics map[string]models.StreamMetrics) error {
+	for streamID, streamMetrics := range metrics {
+		if err := writeJSON(s.path("metrics", streamID, ".json"), streamMetrics); err != nil {
+			return fmt.Errorf("failed to write metrics for stream '%s': %w", streamID, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) DeleteMetrics(streamID string) error {
+	return removeIfExists(s.path("metrics", streamID, ".json"))
+}
+
+func (s *FileStore) SaveMetricsHistory(streamID string, history models.MetricsHistory) error {
+	return writeJSON(s.path("history", streamID, ".json"), history)
+}
+
+func (s *FileStore) LoadMetricsHistory(streamID string) (models.MetricsHistory, bool, error) {
+	var history models.MetricsHistory
+	err := s.read("history", streamID, &history)
+	if os.IsNotExist(err) {
+		return history, false, nil
+	}
+	if err != nil {
+		return history, false, err
+	}
+	return history, true, nil
+}
+
+func (s *FileStore) DeleteMetricsHistory(streamID string) error {
+	return removeIfExists(s.path("history", streamID, ".json"))
+}
+
+func (s *FileStore) SaveDedupeState(streamID string, state models.DedupeState) error {
+	return writeJSON(s.path("dedupe", streamID, ".json"), state)
+}
+
+func (s *FileStore) LoadDedupeState(streamID string) (models.DedupeState, bool, error) {
+	var state models.DedupeState
+	err := s.read("dedupe", streamID, &state)
+	if os.IsNotExist(err) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	return state, true, nil
+}
+
+func (s *FileStore) DeleteDedupeState(streamID string) error {
+	return removeIfExists(s.path("dedupe", streamID, ".json"))
+}
+
+func (s *FileStore) SaveEventSequence(streamID string, sequence int64) error {
+	return writeJSON(s.path("sequences", streamID, ".json"), sequence)
+}
+
+func (s *FileStore) LoadEventSequence(streamID string) (int64, bool, error) {
+	var sequence int64
+	err := s.read("sequences", streamID, &sequence)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return sequence, true, nil
+}
+
+func (s *FileStore) DeleteEventSequence(streamID string) error {
+	return removeIfExists(s.path("sequences", streamID, ".json"))
+}
+
+// AppendDelivery appends a record to the stream's log. The log is trimmed to
+// MaxDeliveries records on the first append after the store is opened and
+// then every MaxDeliveries appends, so it holds at most twice that many lines.
+func (s *FileStore) AppendDelivery(streamID string, record models.DeliveryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path("deliveries", streamID, ".ndjson")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open delivery log: %w", err)
+	}
+	err = json.NewEncoder(file).Encode(record)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write delivery log: %w", err)
+	}
+
+	// The append count is not persisted, so a log left by a previous run is
+	// trimmed as soon as it is appended to
+	appends, counted := s.appends[streamID]
+	s.appends[streamID] = appends + 1
+	if !counted || appends+1 >= MaxDeliveries {
+		s.appends[streamID] = 0
+		records, err := readDeliveries(path)
+		if err != nil {
+			return err
+		}
+		if len(records) <= MaxDeliveries {
+			return nil
+		}
+		records = records[len(records)-MaxDeliveries:]
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		for _, record := range records {
+			encoder.Encode(record)
+		}
+		if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to trim delivery log: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListDeliveries returns up to limit of the stream's most recent deliveries, newest first
+func (s *FileStore) ListDeliveries(streamID string, limit int) ([]models.DeliveryRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := readDeliveries(s.path("deliveries", streamID, ".ndjson"))
+	if err != nil {
+		return nil, err
+	}
+	return newestFirst(records, limit), nil
+}
+
+func (s *FileStore) DeleteDeliveries(streamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.appends, streamID)
+	return removeIfExists(s.path("deliveries", streamID, ".ndjson"))
+}
+
+func (s *FileStore) Close() error {
+	if s.lock == nil {
+		return nil
+	}
+	err := unlockDir(s.lock)
+	s.lock = nil
+	return err
+}
+
+// list returns the names of the files with the given extension in a state
+// directory, creating the directory if it does not exist
+func (s *FileStore) list(kind, ext string) ([]string, error) {
+	dir := filepath.Join(s.Dir, kind)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create %s directory: %w", kind, err)
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ext) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(file.Name(), ext))
+	}
+	return names, nil
+}
+
+func readDeliveries(path string) ([]models.DeliveryRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open delivery log: %w", err)
+	}
+	defer file.Close()
+
+	var records []models.DeliveryRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record models.DeliveryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Skip a line left incomplete by a crash
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func newestFirst(records []models.DeliveryRecord, limit int) []models.DeliveryRecord {
+	if limit <= 0 || limit > len(records) {
+		limit = len(records)
+	}
+	recent := make([]models.DeliveryRecord, limit)
+	for i := range recent {
+		recent[i] = records[len(records)-1-i]
+	}
+	return recent
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -1,70 +1,35 @@
 package storage
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
-
 	"qstreams/internal/models"
 )
 
-var metricsDirectory = "./metrics"
-
-// LoadAllMetrics reads all metrics files from the metrics directory and returns them as a map.
+// LoadAllMetrics reads the metrics of every stream from the state store
 func LoadAllMetrics() (map[string]models.StreamMetrics, error) {
-	files, err := os.ReadDir(metricsDirectory)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Create directory if it doesn't exist
-			if err := os.MkdirAll(metricsDirectory, 0755); err != nil {
-				return nil, err
-			}
-			return make(map[string]models.StreamMetrics), nil
-		}
-		return nil, err
-	}
-
-	metrics := make(map[string]models.StreamMetrics)
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		streamName := file.Name()
-		if filepath.Ext(streamName) == ".json" {
-			streamName = streamName[:len(streamName)-len(filepath.Ext(streamName))]
-			metricFile, err := os.Open(filepath.Join(metricsDirectory, file.Name()))
-			if err != nil {
-				continue
-			}
-			defer metricFile.Close()
+	return Current().LoadAllMetrics()
+}
 
-			var streamMetrics models.StreamMetrics
-			if err := json.NewDecoder(metricFile).Decode(&streamMetrics); err != nil {
-				continue
-			}
+// SaveAllMetrics writes the current metrics of every stream to the state store
+func SaveAllMetrics(metrics map[string]models.StreamMetrics) error {
+	return Current().SaveAllMetrics(metrics)
+}
 
-			metrics[streamName] = streamMetrics
-		}
-	}
+// DeleteMetrics removes the persisted metrics of a stream
+func DeleteMetrics(streamID string) error {
+	return Current().DeleteMetrics(streamID)
+}
 
-	return metrics, nil
+// SaveMetricsHistory writes the metrics time series of a stream
+func SaveMetricsHistory(streamID string, history models.MetricsHistory) error {
+	return Current().SaveMetricsHistory(streamID, history)
 }
 
-// SaveAllMetrics writes the current metrics to individual files in the metrics directory.
-func SaveAllMetrics(metrics map[string]models.StreamMetrics) error {
-	for streamName, streamMetrics := range metrics {
-		filePath := filepath.Join(metricsDirectory, fmt.Sprintf("%s.json", streamName))
-		file, err := os.Create(filePath)
-		if err != nil {
-			return fmt.Errorf("failed to create metrics file for stream '%s': %w", streamName, err)
-		}
-		defer file.Close()
+// LoadMetricsHistory reads the metrics time series of a stream, if any
+func LoadMetricsHistory(streamID string) (models.MetricsHistory, bool, error) {
+	return Current().LoadMetricsHistory(streamID)
+}
 
-		if err := json.NewEncoder(file).Encode(streamMetrics); err != nil {
-			return fmt.Errorf("failed to write metrics for stream '%s': %w", streamName, err)
-		}
-	}
-	return nil
-}
\ No newline at end of file
+// DeleteMetricsHistory removes the metrics time series of a stream
+func DeleteMetricsHistory(streamID string) error {
+	return Current().DeleteMetricsHistory(streamID)
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Migrate copies streams, connection profiles, metrics and their history,
+// dedupe state, CloudEvents sequences and delivery logs from one store to
+// another. Records are copied as stored, so sealed credentials stay sealed and
+// no secret key is needed.
+func Migrate(from, to Store) error {
+	streams, err := from.ListStreams()
+	if err != nil {
+		return fmt.Errorf("failed to list streams: %w", err)
+	}
+	for i := range streams {
+		stream := &streams[i]
+		if err := to.SaveStream(stream); err != nil {
+			return fmt.Errorf("failed to migrate stream '%s': %w", stream.StreamID, err)
+		}
+
+		state, ok, err := from.LoadDedupeState(stream.StreamID)
+		if err != nil {
+			return fmt.Errorf("failed to read dedupe state of stream '%s': %w", stream.StreamID, err)
+		}
+		if ok {
+			if err := to.SaveDedupeState(stream.StreamID, state); err != nil {
+				return fmt.Errorf("failed to migrate dedupe state of stream '%s': %w", stream.StreamID, err)
+			}
+		}
+
+		sequence, ok, err := from.LoadEventSequence(stream.StreamID)
+		if err != nil {
+			return fmt.Errorf("failed to read event sequence of stream '%s': %w", stream.StreamID, err)
+		}
+		if ok {
+			if err := to.SaveEventSequence(stream.StreamID, sequence); err != nil {
+				return fmt.Errorf("failed to migrate event sequence of stream '%s': %w", stream.StreamID, err)
+			}
+		}
+
+		history, ok, err := from.LoadMetricsHistory(stream.StreamID)
+		if err != nil {
+			return fmt.Errorf("failed to read metrics history of stream '%s': %w", stream.StreamID, err)
+		}
+		if ok {
+			if err := to.SaveMetricsHistory(stream.StreamID, history); err != nil {
+				return fmt.Errorf("failed to migrate metrics history of stream '%s': %w", stream.StreamID, err)
+			}
+		}
+
+		records, err := from.ListDeliveries(stream.StreamID, MaxDeliveries)
+		if err != nil {
+			return fmt.Errorf("failed to read delivery log of stream '%s': %w", stream.StreamID, err)
+		}
+		// Records are listed newest first; append them oldest first
+		for j := len(records) - 1; j >= 0; j-- {
+			if err := to.AppendDelivery(stream.StreamID, records[j]); err != nil {
+				return fmt.Errorf("failed to migrate delivery log of stream '%s': %w", stream.StreamID, err)
+			}
+		}
+	}
+
+	connections, err := from.ListConnections()
+	if err != nil {
+		return fmt.Errorf("failed to list connections: %w", err)
+	}
+	for i := range connections {
+		if err := to.SaveConnection(&connections[i]); err != nil {
+			return fmt.Errorf("failed to migrate connection '%s': %w", connections[i].Name, err)
+		}
+	}
+
+	metrics, err := from.LoadAllMetrics()
+	if err != nil {
+		return fmt.Errorf("failed to read metrics: %w", err)
+	}
+	if err := to.SaveAllMetrics(metrics); err != nil {
+		return fmt.Errorf("failed to migrate metrics: %w", err)
+	}
+
+	slog.Info("Migration completed", "streams", len(streams), "connections", len(connections), "metrics", len(metrics))
+	return nil
+}
@@ -1,28 +1,194 @@
 package storage
 
 type QueryStream struct {
-	StreamID    string           `json:"stream_id"`
-	Name        string           `json:"name"`
-	Pinot       PinotConfig      `json:"pinot"`
+	StreamID    string            `json:"stream_id"`
+	Name        string            `json:"name"`
+	Pinot       PinotConfig       `json:"pinot"`
 	Destination DestinationConfig `json:"destination"`
-	Dedupe      DedupeConfig     `json:"dedupe"`
-	State       string           `json:"state"` // Add this field to track stream state
+	Dedupe      DedupeConfig      `json:"dedupe"`
+	Chunking    ChunkingConfig    `json:"chunking"`
+	LogLevel    string            `json:"log_level,omitempty"` // Overrides the global log level for this stream
+	State       string            `json:"state"`               // Add this field to track stream state
 }
 
 type PinotConfig struct {
 	Query          string            `json:"query"`
+	Connection     string            `json:"connection,omitempty"`
 	BrokerURL      string            `json:"broker_url"`
+	ControllerURL  string            `json:"controller_url,omitempty"`
+	Discovery      DiscoveryConfig   `json:"discovery"`
 	QueryInterval  int               `json:"query_interval"`
 	Authentication map[string]string `json:"authentication"`
+	Auth           *AuthConfig       `json:"auth,omitempty"`
+	TLS            *TLSConfig        `json:"tls,omitempty"`
+	Pagination     PaginationConfig  `json:"pagination"`
+	Options        QueryOptions      `json:"options"`
+	// PartialResults is "drop" (the default) to skip results some servers
+	// did not contribute to, or "deliver" to send them flagged as partial
+	PartialResults string `json:"partial_results,omitempty"`
+	// Thresholds flag the stream as slow or expensive in its query stats
+	Thresholds CostThresholds `json:"thresholds"`
+}
+
+// CostThresholds mark a stream slow when its p95 query time exceeds
+// SlowQueryMs, and expensive when it scans more than MaxDocsScanned documents
+// per execution on average. Zero disables a threshold.
+type CostThresholds struct {
+	SlowQueryMs    int64 `json:"slow_query_ms,omitempty"`
+	MaxDocsScanned int64 `json:"max_docs_scanned,omitempty"`
+}
+
+// QueryOptions are sent to the broker with every query. Entries in
+// QueryOptions are passed through as-is; the typed fields take precedence
+// over entries with the same name.
+type QueryOptions struct {
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+	// Booleans are pointers so a stream can switch off an option its
+	// connection profile turns on
+	UseMultistageEngine *bool             `json:"use_multistage_engine,omitempty"`
+	MaxExecutionThreads int               `json:"max_execution_threads,omitempty"`
+	EnableNullHandling  *bool             `json:"enable_null_handling,omitempty"`
+	Trace               *bool             `json:"trace,omitempty"`
+	QueryOptions        map[string]string `json:"query_options,omitempty"`
+}
+
+// Connection is a named Pinot connection profile that streams reference with
+// pinot.connection. Fields set on the stream take precedence over the profile.
+type Connection struct {
+	Name           string            `json:"name"`
+	BrokerURL      string            `json:"broker_url,omitempty"`
+	ControllerURL  string            `json:"controller_url,omitempty"`
+	Authentication map[string]string `json:"authentication,omitempty"`
+	Auth           *AuthConfig       `json:"auth,omitempty"`
+	TLS            *TLSConfig        `json:"tls,omitempty"`
+	Options        QueryOptions      `json:"options"`
+}
+
+// DiscoveryConfig controls broker discovery when ControllerURL is set. Table
+// defaults to the first table in the query's FROM clause and RefreshInterval
+// (milliseconds) to 30 seconds.
+type DiscoveryConfig struct {
+	Table           string `json:"table,omitempty"`
+	RefreshInterval int    `json:"refresh_interval,omitempty"`
+}
+
+// PaginationConfig pages through large results instead of fetching them in
+// one request. Mode is "offset" (LIMIT/OFFSET, the default) or "cursor" for
+// brokers with a response store. MaxRows caps the rows fetched per tick and
+// also applies when pagination is disabled; offset pagination needs MaxRows or
+// a LIMIT in the query. Offset pages are separate queries, so the query
+// should ORDER BY a unique key.
+type PaginationConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Mode     string `json:"mode,omitempty"`
+	PageSize int    `json:"page_size,omitempty"`
+	MaxRows  int    `json:"max_rows,omitempty"`
 }
 
 type DestinationConfig struct {
 	Type           string            `json:"type"`
 	URL            string            `json:"url"`
 	Authentication map[string]string `json:"authentication"`
+	Auth           *AuthConfig       `json:"auth,omitempty"`
+	TLS            *TLSConfig        `json:"tls,omitempty"`
+	Signing        SigningConfig     `json:"signing"`
+	// Format selects the payload encoding: pinot (default), json,
+	// json_columnar, ndjson, csv, msgpack, protobuf, avro or arrow
+	Format      string            `json:"format,omitempty"`
+	Compression CompressionConfig `json:"compression"`
+	// Template renders the body and headers with Go text/template instead
+	// of a built-in format
+	Template TemplateConfig `json:"template"`
+	// CloudEvents wraps every delivery in a CloudEvents 1.0 envelope
+	CloudEvents CloudEventsConfig `json:"cloudevents"`
+	// Options holds settings specific to the destination type
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// AuthConfig selects how credentials are attached to outbound requests. It is
+// applied on top of the static Authentication headers.
+type AuthConfig struct {
+	Type string `json:"type"` // static, basic, oauth2 or file
+
+	// static
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// basic
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// oauth2 client credentials
+	TokenURL       string            `json:"token_url,omitempty"`
+	ClientID       string            `json:"client_id,omitempty"`
+	ClientSecret   string            `json:"client_secret,omitempty"`
+	Scopes         []string          `json:"scopes,omitempty"`
+	EndpointParams map[string]string `json:"endpoint_params,omitempty"`
+	ClientAuth     string            `json:"client_auth,omitempty"` // header (default) or body
+
+	// file
+	TokenFile string `json:"token_file,omitempty"`
+
+	// Header and scheme used for oauth2 and file tokens, defaulting to
+	// "Authorization: Bearer <token>"
+	HeaderName string `json:"header_name,omitempty"`
+	Scheme     string `json:"scheme,omitempty"`
+}
+
+// TLSConfig customizes TLS for outbound connections. Files are PEM encoded and
+// are reloaded when they change on disk.
+type TLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	MinVersion         string `json:"min_version,omitempty"` // 1.0, 1.1, 1.2 (default) or 1.3
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// SigningConfig controls HMAC-SHA256 signing of outbound deliveries. At most
+// two secrets are active at once; the first signs with the current secret and
+// the second keeps receivers that still hold the previous one working while
+// a rotation is rolled out.
+type SigningConfig struct {
+	Enabled bool     `json:"enabled"`
+	Secrets []string `json:"secrets,omitempty"`
+	Header  string   `json:"header,omitempty"`
+}
+
+// ChunkingConfig splits a result into several deliveries of at most Rows rows
+// and roughly Bytes bytes each. Zero disables the corresponding bound.
+type ChunkingConfig struct {
+	Rows  int `json:"rows,omitempty"`
+	Bytes int `json:"bytes,omitempty"`
+}
+
+// TemplateConfig holds Go text/template sources rendered against each
+// delivery's rows, columns, stream metadata and the previous result
+type TemplateConfig struct {
+	Body        string            `json:"body,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+}
+
+// CloudEventsConfig wraps deliveries as CloudEvents. Mode is "structured"
+// (the default) or "binary". Source and Type default to values derived from
+// the qstreams instance, stream ID and stream name.
+type CloudEventsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// CompressionConfig compresses payloads of at least MinBytes bytes with
+// Algorithm (gzip, zstd or snappy) before they are delivered.
+type CompressionConfig struct {
+	Algorithm string `json:"algorithm,omitempty"`
+	Level     string `json:"level,omitempty"` // fastest, default or best
+	MinBytes  int    `json:"min_bytes,omitempty"`
 }
 
 type DedupeConfig struct {
 	Enabled  bool `json:"enabled"`
 	Duration int  `json:"duration"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"fmt"
+
+	"qstreams/internal/secrets"
+)
+
+// secretFunc transforms one credential value
+type secretFunc func(value string) (string, error)
+
+// transformStream returns a copy of stream with fn applied to every
+// credential: auth headers, passwords, client secrets, webhook header options
+// and signing secrets. The original stream is not modified.
+func transformStream(stream QueryStream, fn secretFunc) (QueryStream, error) {
+	var err error
+	if stream.Pinot.Authentication, err = transformHeaders(stream.Pinot.Authentication, fn); err != nil {
+		return stream, err
+	}
+	if stream.Pinot.Auth, err = transformAuth(stream.Pinot.Auth, fn); err != nil {
+		return stream, err
+	}
+	if stream.Destination.Authentication, err = transformHeaders(stream.Destination.Authentication, fn); err != nil {
+		return stream, err
+	}
+	if stream.Destination.Auth, err = transformAuth(stream.Destination.Auth, fn); err != nil {
+		return stream, err
+	}
+	if stream.Destination.Options, err = transformOptions(stream.Destination.Options, fn); err != nil {
+		return stream, err
+	}
+	if stream.Destination.Signing.Secrets != nil {
+		values := make([]string, len(stream.Destination.Signing.Secrets))
+		for i, value := range stream.Destination.Signing.Secrets {
+			if values[i], err = fn(value); err != nil {
+				return stream, err
+			}
+		}
+		stream.Destination.Signing.Secrets = values
+	}
+	return stream, nil
+}
+
+// transformConnection returns a copy of connection with fn applied to every credential
+func transformConnection(connection Connection, fn secretFunc) (Connection, error) {
+	var err error
+	if connection.Authentication, err = transformHeaders(connection.Authentication, fn); err != nil {
+		return connection, err
+	}
+	if connection.Auth, err = transformAuth(connection.Auth, fn); err != nil {
+		return connection, err
+	}
+	return connection, nil
+}
+
+func transformHeaders(headers map[string]string, fn secretFunc) (map[string]string, error) {
+	if headers == nil {
+		return nil, nil
+	}
+	values := make(map[string]string, len(headers))
+	for name, value := range headers {
+		transformed, err := fn(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		values[name] = transformed
+	}
+	return values, nil
+}
+
+func transformAuth(auth *AuthConfig, fn secretFunc) (*AuthConfig, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	copied := *auth
+	var err error
+	if copied.Headers, err = transformHeaders(auth.Headers, fn); err != nil {
+		return nil, err
+	}
+	if copied.Password, err = fn(auth.Password); err != nil {
+		return nil, err
+	}
+	if copied.ClientSecret, err = fn(auth.ClientSecret); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// transformOptions applies fn to the "headers" destination option
+func transformOptions(options map[string]interface{}, fn secretFunc) (map[string]interface{}, error) {
+	headers, ok := options["headers"].(map[string]interface{})
+	if !ok {
+		return options, nil
+	}
+	copied := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		copied[key] = value
+	}
+	transformed := make(map[string]interface{}, len(headers))
+	for name, value := range headers {
+		text, ok := value.(string)
+		if !ok {
+			transformed[name] = value
+			continue
+		}
+		result, err := fn(text)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		transformed[name] = result
+	}
+	copied["headers"] = transformed
+	return copied, nil
+}
+
+func redact(value string) (string, error) {
+	return secrets.Redact(value), nil
+}
+
+// RedactStream returns a copy of stream with its credentials hidden
+func RedactStream(stream QueryStream) QueryStream {
+	redacted, _ := transformStream(stream, redact)
+	return redacted
+}
+
+// RedactConnection returns a copy of connection with its credentials hidden
+func RedactConnection(connection Connection) Connection {
+	redacted, _ := transformConnection(connection, redact)
+	return redacted
+}
+
+// RestoreRedactedStream replaces redacted placeholders in an update with the
+// values stored in existing, so a stream read from the API can be sent back
+// unchanged. Redacted signing secrets take the existing secrets in order.
+func RestoreRedactedStream(updated *QueryStream, existing *QueryStream) {
+	restoreHeaders(updated.Pinot.Authentication, existing.Pinot.Authentication)
+	restoreAuth(updated.Pinot.Auth, existing.Pinot.Auth)
+	restoreHeaders(updated.Destination.Authentication, existing.Destination.Authentication)
+	restoreAuth(updated.Destination.Auth, existing.Destination.Auth)
+
+	if headers, ok := updated.Destination.Options["headers"].(map[string]interface{}); ok {
+		previous, _ := existing.Destination.Options["headers"].(map[string]interface{})
+		for name, value := range headers {
+			if value == secrets.Redacted {
+				headers[name] = previous[name]
+			}
+		}
+	}
+
+	next := 0
+	kept := updated.Destination.Signing.Secrets[:0]
+	for _, value := range updated.Destination.Signing.Secrets {
+		if value == secrets.Redacted {
+			if next >= len(existing.Destination.Signing.Secrets) {
+				continue
+			}
+			value = existing.Destination.Signing.Secrets[next]
+			next++
+		}
+		kept = append(kept, value)
+	}
+	updated.Destination.Signing.Secrets = kept
+}
+
+// RestoreRedactedConnection is RestoreRedactedStream for connection profiles
+func RestoreRedactedConnection(updated *Connection, existing *Connection) {
+	restoreHeaders(updated.Authentication, existing.Authentication)
+	restoreAuth(updated.Auth, existing.Auth)
+}
+
+func restoreHeaders(updated, existing map[string]string) {
+	for name, value := range updated {
+		if value == secrets.Redacted {
+			updated[name] = existing[name]
+		}
+	}
+}
+
+func restoreAuth(updated, existing *AuthConfig) {
+	if updated == nil {
+		return
+	}
+	if existing == nil {
+		existing = &AuthConfig{}
+	}
+	restoreHeaders(updated.Headers, existing.Headers)
+	if updated.Password == secrets.Redacted {
+		updated.Password = existing.Password
+	}
+	if updated.ClientSecret == secrets.Redacted {
+		updated.ClientSecret = existing.ClientSecret
+	}
+}
@@ -1,82 +1,102 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-)
+	"log/slog"
 
-var streamDirectory = "./streams"
+	"qstreams/internal/models"
+	"qstreams/internal/secrets"
+	"qstreams/shared/utils"
+)
 
-// SaveStream writes a stream's configuration to a file using its StreamID
+// SaveStream writes a stream's configuration to the state store using its StreamID
 func SaveStream(stream *QueryStream) error {
-	filePath := filepath.Join(streamDirectory, fmt.Sprintf("%s.json", stream.StreamID))
-	file, err := os.Create(filePath)
+	// Credentials are encrypted at rest when a secret key is configured
+	sealed, err := transformStream(*stream, secrets.Encrypt)
 	if err != nil {
-		return fmt.Errorf("failed to create stream file: %w", err)
+		return fmt.Errorf("failed to encrypt stream secrets: %w", err)
 	}
-	defer file.Close()
-
-	return json.NewEncoder(file).Encode(stream)
+	return Current().SaveStream(&sealed)
 }
 
-// LoadStream reads a stream's configuration from its file by StreamID
+// LoadStream reads a stream's configuration from the state store by StreamID
 func LoadStream(streamID string) (*QueryStream, error) {
-	filePath := filepath.Join(streamDirectory, fmt.Sprintf("%s.json", streamID))
-	file, err := os.Open(filePath)
+	stream, err := Current().LoadStream(streamID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open stream file: %w", err)
+		return nil, fmt.Errorf("failed to load stream: %w", err)
 	}
-	defer file.Close()
 
-	var stream QueryStream
-	if err := json.NewDecoder(file).Decode(&stream); err != nil {
-		return nil, fmt.Errorf("failed to decode stream file: %w", err)
+	opened, err := transformStream(*stream, secrets.Decrypt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt stream secrets: %w", err)
 	}
-
-	return &stream, nil
+	return &opened, nil
 }
 
 // ListStreams reads all stream configurations in the state store
 func ListStreams() ([]QueryStream, error) {
-	files, err := os.ReadDir(streamDirectory)
+	stored, err := Current().ListStreams()
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Create directory if it doesn't exist
-			if err := os.MkdirAll(streamDirectory, 0755); err != nil {
-				return nil, fmt.Errorf("failed to create stream directory: %w", err)
-			}
-			return []QueryStream{}, nil
-		}
 		return nil, err
 	}
 
 	var streams []QueryStream
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		filePath := filepath.Join(streamDirectory, file.Name())
-		stream, err := LoadStream(file.Name()[:len(file.Name())-len(".json")])
+	for _, stream := range stored {
+		opened, err := transformStream(stream, secrets.Decrypt)
 		if err != nil {
-			log.Printf("Skipping invalid stream file: %s", filePath)
+			slog.Warn("Skipping invalid stream", utils.FieldStreamID, stream.StreamID, "error", err)
 			continue
 		}
-		streams = append(streams, *stream)
+		streams = append(streams, opened)
 	}
-
 	return streams, nil
 }
 
-// GetStreamFilePath returns the file path for a given stream ID
-func GetStreamFilePath(streamID string) string {
-	return filepath.Join(streamDirectory, fmt.Sprintf("%s.json", streamID))
+// DeleteStream removes a stream's configuration along with its dedupe state,
+// CloudEvents sequence and delivery log
+func DeleteStream(streamID string) error {
+	store := Current()
+	if err := store.DeleteStream(streamID); err != nil {
+		return err
+	}
+	if err := store.DeleteDedupeState(streamID); err != nil {
+		slog.Error("Failed to delete dedupe state", utils.FieldStreamID, streamID, "error", err)
+	}
+	if err := store.DeleteEventSequence(streamID); err != nil {
+		slog.Error("Failed to delete event sequence", utils.FieldStreamID, streamID, "error", err)
+	}
+	if err := store.DeleteDeliveries(streamID); err != nil {
+		slog.Error("Failed to delete delivery log", utils.FieldStreamID, streamID, "error", err)
+	}
+	return nil
+}
+
+// SaveDedupeState records the last result hash delivered by a stream
+func SaveDedupeState(streamID string, state models.DedupeState) error {
+	return Current().SaveDedupeState(streamID, state)
+}
+
+// LoadDedupeState returns the last result hash delivered by a stream, if any
+func LoadDedupeState(streamID string) (models.DedupeState, bool, error) {
+	return Current().LoadDedupeState(streamID)
+}
+
+// SaveEventSequence records the last CloudEvents id used by a stream
+func SaveEventSequence(streamID string, sequence int64) error {
+	return Current().SaveEventSequence(streamID, sequence)
+}
+
+// LoadEventSequence returns the last CloudEvents id used by a stream, if any
+func LoadEventSequence(streamID string) (int64, bool, error) {
+	return Current().LoadEventSequence(streamID)
 }
 
-// DeleteStreamFile deletes a stream file by its file path
-func DeleteStreamFile(filePath string) error {
-	return os.Remove(filePath)
-}
\ No newline at end of file
+// AppendDelivery adds a record to a stream's delivery log
+func AppendDelivery(streamID string, record models.DeliveryRecord) error {
+	return Current().AppendDelivery(streamID, record)
+}
+
+// ListDeliveries returns up to limit of a stream's most recent deliveries, newest first
+func ListDeliveries(streamID string, limit int) ([]models.DeliveryRecord, error) {
+	return Current().ListDeliveries(streamID, limit)
+}
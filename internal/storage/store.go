@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"qstreams/internal/models"
+)
+
+// Store persists streams, connection profiles, metrics and their history,
+// dedupe state and delivery logs. Backends store values as given; credentials are sealed and
+// opened by the package-level functions before they reach a Store.
+type Store interface {
+	SaveStream(stream *QueryStream) error
+	LoadStream(streamID string) (*QueryStream, error)
+	ListStreams() ([]QueryStream, error)
+	DeleteStream(streamID string) error
+
+	SaveConnection(connection *Connection) error
+	LoadConnection(name string) (*Connection, error)
+	ListConnections() ([]Connection, error)
+	DeleteConnection(name string) error
+
+	LoadAllMetrics() (map[string]models.StreamMetrics, error)
+	SaveAllMetrics(metrics map[string]models.StreamMetrics) error
+	DeleteMetrics(streamID string) error
+
+	SaveMetricsHistory(streamID string, history models.MetricsHistory) error
+	LoadMetricsHistory(streamID string) (models.MetricsHistory, bool, error)
+	DeleteMetricsHistory(streamID string) error
+
+	SaveDedupeState(streamID string, state models.DedupeState) error
+	LoadDedupeState(streamID string) (models.DedupeState, bool, error)
+	DeleteDedupeState(streamID string) error
+
+	SaveEventSequence(streamID string, sequence int64) error
+	LoadEventSequence(streamID string) (int64, bool, error)
+	DeleteEventSequence(streamID string) error
+
+	AppendDelivery(streamID string, record models.DeliveryRecord) error
+	ListDeliveries(streamID string, limit int) ([]models.DeliveryRecord, error)
+	DeleteDeliveries(streamID string) error
+
+	Close() error
+}
+
+// Quarantiner is implemented by stores that move aside records they cannot decode
+type Quarantiner interface {
+	Quarantined() ([]models.QuarantinedFile, error)
+}
+
+// Backends selectable with Open
+const (
+	BackendFile = "file"
+	BackendBolt = "bolt"
+)
+
+// MaxDeliveries is the number of delivery records kept per stream
+const MaxDeliveries = 1000
+
+var current = struct {
+	sync.RWMutex
+	store Store
+}{
+	store: NewFileStore("."),
+}
+
+// Open opens a store backend. For the file backend path is the directory
+// holding the streams, metrics and other state directories; for bolt it is
+// the database file.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case "", BackendFile:
+		if path == "" {
+			path = "."
+		}
+		return OpenFileStore(path)
+	case BackendBolt:
+		if path == "" {
+			path = "qstreams.db"
+		}
+		return OpenBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q (expected 'file' or 'bolt')", backend)
+	}
+}
+
+// SetStore replaces the store used by the package-level functions
+func SetStore(store Store) {
+	current.Lock()
+	defer current.Unlock()
+	current.store = store
+}
+
+// Current returns the store used by the package-level functions
+func Current() Store {
+	current.RLock()
+	defer current.RUnlock()
+	return current.store
+}
+
+// Quarantined lists the records the current store has moved aside as corrupt
+func Quarantined() ([]models.QuarantinedFile, error) {
+	if quarantiner, ok := Current().(Quarantiner); ok {
+		return quarantiner.Quarantined()
+	}
+	return []models.QuarantinedFile{}, nil
+}
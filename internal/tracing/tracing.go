@@ -0,0 +1,97 @@
+// Package tracing records each stream tick as an OpenTelemetry trace and
+// propagates its context to destinations with the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters selectable with Configure
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// ServiceName is reported as service.name on every span
+const ServiceName = "qstreams"
+
+var tracer = otel.Tracer("qstreams")
+
+// Configure installs the exporter spans are sent to. With ExporterNone spans
+// are not recorded. For ExporterOTLP endpoint is the collector's OTLP/HTTP
+// URL, such as http://localhost:4318; when empty the standard
+// OTEL_EXPORTER_OTLP_* environment variables apply. sampleRatio is the
+// fraction of ticks traced.
+//
+// The returned shutdown function exports spans still batched in memory and
+// must be called before the process exits.
+func Configure(exporter, endpoint string, sampleRatio float64) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	noop := func(context.Context) error { return nil }
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return noop, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		return noop, fmt.Errorf("unknown tracing exporter %q (expected 'none', 'stdout' or 'otlp')", exporter)
+	}
+	if err != nil {
+		return noop, fmt.Errorf("failed to create %s exporter: %w", exporter, err)
+	}
+
+	serviceResource, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", ServiceName)))
+	if err != nil {
+		return noop, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter, sdktrace.WithBatchTimeout(time.Second)),
+		sdktrace.WithResource(serviceResource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, options...)
+}
+
+// End ends a span, marking it failed when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject adds the traceparent header of the span in ctx to an outgoing request
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,246 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"qstreams/internal/cloudevents"
+	"qstreams/internal/compress"
+	"qstreams/internal/destinations"
+	"qstreams/internal/format"
+	"qstreams/internal/metrics"
+	"qstreams/internal/models"
+	"qstreams/internal/pinot"
+	"qstreams/internal/storage"
+	"qstreams/internal/tracing"
+	"qstreams/shared/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sender turns query results into deliveries for one stream's destination
+type sender struct {
+	stream          *storage.QueryStream
+	dest            destinations.Destination
+	encoder         format.Encoder
+	headerTemplates *format.HeaderTemplates
+	logger          *slog.Logger
+
+	// previous is the last delivered result, made available to templates
+	previous *pinot.BrokerResponse
+	// sequence numbers CloudEvents ids and is saved to the state store
+	// before each event is sent, so ids are not reused after a crash
+	sequence int64
+}
+
+func newSender(stream *storage.QueryStream, dest destinations.Destination, logger *slog.Logger) (*sender, error) {
+	encoder, headerTemplates, err := format.NewEncoder(stream.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	// Streams from before the sequence was stored kept it with their metrics
+	metrics.Cache.Lock()
+	sequence := metrics.Cache.Data[stream.StreamID].EventSequence
+	metrics.Cache.Unlock()
+	stored, _, err := storage.LoadEventSequence(stream.StreamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load event sequence: %w", err)
+	}
+	sequence = max(sequence, stored)
+
+	return &sender{
+		stream:          stream,
+		dest:            dest,
+		encoder:         encoder,
+		headerTemplates: headerTemplates,
+		logger:          logger.With(utils.FieldDestination, stream.Destination.Type),
+		sequence:        sequence,
+	}, nil
+}
+
+// send encodes, wraps, compresses and delivers one chunk, returning the
+// payload size before and after compression
+func (s *sender) send(ctx context.Context, response *pinot.BrokerResponse, chunk pinot.Chunk) (int, int, error) {
+	stream := s.stream
+	result := &format.Result{
+		StreamID:   stream.StreamID,
+		StreamName: stream.Name,
+		Response:   response,
+		Previous:   s.previous,
+	}
+	headers := map[string]string{}
+	if response.ResultTable != nil {
+		copied := *response
+		table := *response.ResultTable
+		table.Rows = chunk.Rows
+		copied.ResultTable = &table
+		result.Response = &copied
+	}
+	if response.Partial() {
+		headers["X-QStreams-Partial-Result"] = "true"
+	}
+	if stream.Chunking.Rows > 0 || stream.Chunking.Bytes > 0 {
+		result.Chunk = &format.ChunkInfo{Index: chunk.Index, Total: chunk.Total}
+		headers["X-QStreams-Chunk-Index"] = strconv.Itoa(chunk.Index)
+		headers["X-QStreams-Chunk-Total"] = strconv.Itoa(chunk.Total)
+	}
+
+	// Encode, render templates, wrap and compress the payload
+	_, transformSpan := tracing.Start(ctx, "transform", trace.WithAttributes(attribute.Int("chunk_index", chunk.Index)))
+	payload, err := s.encoder.Encode(result)
+	if err != nil {
+		tracing.End(transformSpan, err)
+		return 0, 0, fmt.Errorf("failed to encode delivery: %w", err)
+	}
+	contentType := s.encoder.ContentType()
+	if s.headerTemplates != nil {
+		rendered, err := s.headerTemplates.Render(result)
+		if err != nil {
+			tracing.End(transformSpan, err)
+			return 0, 0, err
+		}
+		for name, value := range rendered {
+			headers[name] = value
+		}
+	}
+
+	// Wrap the payload in a CloudEvents envelope
+	now := time.Now()
+	if stream.Destination.CloudEvents.Enabled {
+		if err := storage.SaveEventSequence(stream.StreamID, s.sequence+1); err != nil {
+			tracing.End(transformSpan, err)
+			return 0, 0, fmt.Errorf("failed to save event sequence: %w", err)
+		}
+		s.sequence++
+		payload, contentType, err = s.wrap(payload, contentType, headers, result.Chunk, now)
+		if err != nil {
+			tracing.End(transformSpan, err)
+			return 0, 0, fmt.Errorf("failed to wrap delivery as a CloudEvent: %w", err)
+		}
+	}
+
+	// Compress payloads above the threshold unless the receiver rejected the algorithm
+	before := len(payload)
+	encoding := ""
+	compression := stream.Destination.Compression
+	if compression.Algorithm != "" && before >= compression.MinBytes && acceptsEncoding(s.dest, compression.Algorithm) {
+		compressed, err := compress.Compress(compression.Algorithm, compression.Level, payload)
+		if err != nil {
+			tracing.End(transformSpan, err)
+			return before, before, fmt.Errorf("failed to compress delivery: %w", err)
+		}
+		payload = compressed
+		encoding = compression.Algorithm
+	}
+	transformSpan.SetAttributes(attribute.Int("bytes", before), attribute.Int("compressed_bytes", len(payload)))
+	transformSpan.End()
+
+	delivery := destinations.Delivery{
+		StreamID:        stream.StreamID,
+		StreamName:      stream.Name,
+		Payload:         payload,
+		ContentType:     contentType,
+		ContentEncoding: encoding,
+		Headers:         headers,
+		Timestamp:       now,
+	}
+	// The span is propagated to HTTP destinations as traceparent
+	sendCtx, sendSpan := tracing.Start(ctx, "destination.send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String(utils.FieldDestination, stream.Destination.Type),
+		attribute.Int("chunk_index", chunk.Index),
+		attribute.Int("bytes", len(payload)),
+	))
+	err = s.dest.Send(sendCtx, delivery)
+	tracing.End(sendSpan, err)
+	if err != nil {
+		return before, len(payload), fmt.Errorf("failed to send to destination: %w", err)
+	}
+	return before, len(payload), nil
+}
+
+// record appends the outcome of a chunk delivery to the stream's delivery log
+func (s *sender) record(chunk pinot.Chunk, size int, started time.Time, err error) {
+	metrics.ObserveDelivery(s.stream.StreamID, s.stream.Destination.Type, time.Since(started).Seconds())
+	record := models.DeliveryRecord{
+		At:         started,
+		ChunkIndex: chunk.Index,
+		ChunkTotal: chunk.Total,
+		Rows:       len(chunk.Rows),
+		Bytes:      size,
+		DurationMs: time.Since(started).Milliseconds(),
+		Success:    err == nil,
+	}
+	if s.stream.Destination.CloudEvents.Enabled {
+		record.Sequence = s.sequence
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		s.logger.Debug("Delivered chunk", "chunk_index", chunk.Index, "rows", record.Rows, "bytes", size, "duration_ms", record.DurationMs)
+	}
+	if err := storage.AppendDelivery(s.stream.StreamID, record); err != nil {
+		s.logger.Error("Failed to record delivery", "error", err)
+	}
+}
+
+// wrap builds the CloudEvents form of a payload. In structured mode the event
+// becomes the body; in binary mode the body is unchanged and the context
+// attributes are added to headers using the destination protocol's binding.
+func (s *sender) wrap(payload []byte, contentType string, headers map[string]string, chunk *format.ChunkInfo, now time.Time) ([]byte, string, error) {
+	config := s.stream.Destination.CloudEvents
+	event := cloudevents.Event{
+		ID:              strconv.FormatInt(s.sequence, 10),
+		Source:          config.Source,
+		Type:            config.Type,
+		Subject:         s.stream.StreamID,
+		Time:            now,
+		DataContentType: contentType,
+		Data:            payload,
+	}
+	if event.Source == "" {
+		event.Source = cloudevents.Source(s.stream.StreamID)
+	}
+	if event.Type == "" {
+		event.Type = cloudevents.Type(s.stream.Name)
+	}
+	if chunk != nil {
+		event.Extensions = map[string]string{
+			"chunkindex": strconv.Itoa(chunk.Index),
+			"chunktotal": strconv.Itoa(chunk.Total),
+		}
+	}
+
+	if config.Mode == cloudevents.ModeBinary {
+		var attributes map[string]string
+		switch s.dest.Capabilities().Protocol {
+		case "kafka":
+			attributes = event.KafkaHeaders()
+		case "amqp":
+			attributes = event.AMQPProperties()
+		default:
+			attributes = event.HTTPHeaders()
+		}
+		for name, value := range attributes {
+			headers[name] = value
+		}
+		return payload, contentType, nil
+	}
+
+	structured, err := event.Structured()
+	if err != nil {
+		return nil, "", err
+	}
+	return structured, cloudevents.StructuredContentType, nil
+}
+
+func acceptsEncoding(dest destinations.Destination, algorithm string) bool {
+	if negotiator, ok := dest.(destinations.EncodingNegotiator); ok {
+		return negotiator.AcceptsEncoding(algorithm)
+	}
+	return true
+}
@@ -1,163 +1,462 @@
 package worker
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"sync"
 	"time"
 
+	"qstreams/internal/auth"
+	"qstreams/internal/config"
+	"qstreams/internal/connections"
 	"qstreams/internal/destinations"
+	"qstreams/internal/httpclient"
 	"qstreams/internal/metrics"
+	"qstreams/internal/models"
+	"qstreams/internal/pinot"
+	"qstreams/internal/status"
 	"qstreams/internal/storage"
-)
+	"qstreams/internal/tracing"
+	"qstreams/shared/utils"
 
-type dedupeCache struct {
-	Hash      string
-	LastSent  time.Time
-}
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
 
+// dedupeStore caches the persisted dedupe state of each stream by StreamID
 var dedupeStore = struct {
 	sync.Mutex
-	Cache map[string]dedupeCache
-}{Cache: make(map[string]dedupeCache)}
+	Cache map[string]models.DedupeState
+}{Cache: make(map[string]models.DedupeState)}
+
+// workers tracks running workers so they can be stopped on shutdown
+var workers = struct {
+	sync.Mutex
+	running  sync.WaitGroup
+	stopping bool
+	stop     chan struct{}
+}{stop: make(chan struct{})}
+
+// StopWorkers stops every stream worker after its current tick and waits for
+// them to return or ctx to expire. Stream states are left as they are so the
+// streams are restored on the next start.
+func StopWorkers(ctx context.Context) error {
+	workers.Lock()
+	if !workers.stopping {
+		workers.stopping = true
+		close(workers.stop)
+	}
+	workers.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workers.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
 func RunStreamWorker(stream *storage.QueryStream, dest destinations.Destination) {
+	defer dest.Close()
+
+	workers.Lock()
+	if workers.stopping {
+		workers.Unlock()
+		return
+	}
+	workers.running.Add(1)
+	workers.Unlock()
+	defer workers.running.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Set the stream state to "running"
 	stream.State = "running"
 	storage.SaveStream(stream) // Persist state to disk
-	log.Printf("Stream '%s' is now active (state: 'running', StreamID: '%s').", stream.Name, stream.StreamID)
+	logger := utils.StreamLogger(stream.StreamID, stream.Name)
+	if err := utils.SetStreamLevel(stream.StreamID, stream.LogLevel); err != nil {
+		logger.Warn("Ignoring invalid log level", "log_level", stream.LogLevel, "error", err)
+	}
+	logger.Info("Stream is now active", "state", stream.State)
+	metrics.WorkerStarted()
+	defer metrics.WorkerStopped()
+
+	// Build the Pinot client once so cached tokens survive across ticks
+	connectionVersion := connections.Version(stream.Pinot.Connection)
+	client, err := newPinotClient(stream)
+	if err != nil {
+		logger.Error("Failed to create Pinot client", "error", err)
+		return
+	}
 
-	ticker := time.NewTicker(time.Duration(stream.Pinot.QueryInterval) * time.Millisecond)
+	sender, err := newSender(stream, dest, logger)
+	if err != nil {
+		logger.Error("Invalid destination format", utils.FieldDestination, stream.Destination.Type, "error", err)
+		return
+	}
+
+	interval := time.Duration(stream.Pinot.QueryInterval) * time.Millisecond
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	status.Update(stream.StreamID, func(current *models.StreamStatus) {
+		next := time.Now().Add(interval)
+		current.IntervalMs = interval.Milliseconds()
+		current.NextRunAt = &next
+	})
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-workers.stop:
+			logger.Info("Stream worker stopped for shutdown")
+			return
+		case tick := <-ticker.C:
 			// Stop if the stream is no longer in the "running" state
 			if stream.State != "running" {
-				log.Printf("Stream '%s' (StreamID: '%s') is no longer active (state: '%s').", stream.Name, stream.StreamID, stream.State)
+				logger.Info("Stream is no longer active", "state", stream.State)
 				return
 			}
 
-			// Prepare the Pinot query payload
-			queryPayload := map[string]string{"sql": stream.Pinot.Query}
-			payload, _ := json.Marshal(queryPayload)
+			// Trace the tick from the time it was scheduled
+			tickCtx, tickSpan := tracing.Start(ctx, "stream.tick", trace.WithTimestamp(tick), trace.WithAttributes(
+				attribute.String(utils.FieldStreamID, stream.StreamID),
+				attribute.String(utils.FieldStreamName, stream.Name),
+			))
+			_, scheduleSpan := tracing.Start(tickCtx, "schedule", trace.WithTimestamp(tick))
 
-			// Create the HTTP request to Pinot
-			req, err := http.NewRequest("POST", stream.Pinot.BrokerURL, bytes.NewBuffer(payload))
-			if err != nil {
-				log.Printf("Stream '%s' (StreamID: '%s'): Failed to create Pinot query request. Error: %v", stream.Name, stream.StreamID, err)
-				continue
+			// Reconnect when the stream's connection profile has changed
+			if stream.Pinot.Connection != "" {
+				if version := connections.Version(stream.Pinot.Connection); version != connectionVersion {
+					connectionVersion = version
+					if updated, err := newPinotClient(stream); err != nil {
+						logger.Warn("Keeping previous connection", "connection", stream.Pinot.Connection, "error", err)
+					} else {
+						client = updated
+						logger.Info("Connection changed, reconnected", "connection", stream.Pinot.Connection)
+					}
+				}
 			}
-			req.Header.Set("Content-Type", "application/json")
+			scheduleSpan.End()
 
-			// Add Pinot authentication headers
-			for key, value := range stream.Pinot.Authentication {
-				req.Header.Set(key, value)
+			// Query Pinot, paging through the result if configured
+			started := time.Now()
+			queryCtx, querySpan := tracing.Start(tickCtx, "pinot.query")
+			response, err := pinot.Fetch(queryCtx, client, stream.Pinot)
+			metrics.ObserveQuery(stream.StreamID, time.Since(started).Seconds())
+			if client.Pool != nil {
+				recordBrokers(stream.StreamID, client.Pool.Brokers())
+			}
+			queryLogger := logger
+			if response != nil {
+				queryLogger = logger.With(utils.FieldBroker, response.Broker)
+				metrics.RecordQuery(stream.StreamID, stream.Pinot.Thresholds, querySample(response))
+				queryLogger.Debug("Query executed", "rows", len(response.Rows()), "time_used_ms", response.TimeUsedMs)
+			}
+			if err == nil {
+				if queryErr := pinot.CheckResponse(response); queryErr != nil {
+					err = queryErr
+				}
+			}
+			if response != nil {
+				querySpan.SetAttributes(
+					attribute.String(utils.FieldBroker, response.Broker),
+					attribute.Int("rows", len(response.Rows())),
+					attribute.Int64("time_used_ms", response.TimeUsedMs),
+				)
 			}
-
-			// Execute the query
-			client := &http.Client{Timeout: 10 * time.Second}
-			resp, err := client.Do(req)
 			if err != nil {
-				log.Printf("Stream '%s' (StreamID: '%s'): Failed to query Pinot. Error: %v", stream.Name, stream.StreamID, err)
-				continue
+				querySpan.SetAttributes(attribute.String("error_class", pinot.ErrorClass(err)))
 			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				log.Printf("Stream '%s' (StreamID: '%s'): Pinot query failed with status %d.", stream.Name, stream.StreamID, resp.StatusCode)
-				continue
+			tracing.End(querySpan, err)
+			if err != nil {
+				var queryErr *pinot.QueryError
+				deliver := errors.As(err, &queryErr) && queryErr.Partial() && stream.Pinot.PartialResults == "deliver"
+				recordError(stream.StreamID, err, deliver)
+				if !deliver {
+					queryLogger.Error("Query failed", "error_class", pinot.ErrorClass(err), "error", err)
+					recordRun(stream.StreamID, interval, run{started: started, queryErr: true, noResult: true})
+					tracing.End(tickSpan, err)
+					continue
+				}
+				queryLogger.Warn("Delivering partial result", "error", err)
+				response.PartialResult = true
+			} else {
+				recordSuccess(stream.StreamID)
 			}
 
 			// Handle deduplication
 			deduped := false
+			var dedupeHash string
 			if stream.Dedupe.Enabled {
-				if skip := handleDeduplication(stream, payload); skip {
-					deduped = true
+				_, dedupeSpan := tracing.Start(tickCtx, "dedupe")
+				result, _ := json.Marshal(response.ResultTable)
+				deduped, dedupeHash = handleDeduplication(stream, result, logger)
+				dedupeSpan.SetAttributes(attribute.Bool("deduped", deduped))
+				dedupeSpan.End()
+			}
+
+			// Push results to the destination, one delivery per chunk
+			sent, failed := 0, 0
+			var deliveryErr error
+			var bytesBefore, bytesAfter int64
+			if !deduped {
+				chunks := pinot.Split(response.Rows(), stream.Chunking.Rows, stream.Chunking.Bytes)
+				for _, chunk := range chunks {
+					sent++
+					started := time.Now()
+					before, after, err := sender.send(tickCtx, response, chunk)
+					sender.record(chunk, after, started, err)
+					if err != nil {
+						failed++
+						deliveryErr = err
+						logger.Error("Failed to push data to destination", utils.FieldDestination, stream.Destination.Type, "chunk_index", chunk.Index, "error", err)
+					}
+					bytesBefore += int64(before)
+					bytesAfter += int64(after)
+				}
+				// Templates and dedupe see the last result the destination
+				// received in full
+				if failed == 0 {
+					sender.previous = response
+					if stream.Dedupe.Enabled {
+						recordDelivered(stream, dedupeHash, logger)
+					}
 				}
 			}
+			recordRun(stream.StreamID, interval, run{
+				started:     started,
+				rows:        len(response.Rows()),
+				queryErr:    err != nil,
+				delivered:   sent - failed,
+				deliveryErr: deliveryErr,
+			})
 
-			// Update metrics and push results to the destination
+			// Update metrics
 			metrics.Cache.Lock()
 			metricsData := metrics.Cache.Data[stream.StreamID]
-			metricsData.NumberOfQueries++
-
 			if deduped {
 				metricsData.EventsDeduped++
-			} else {
-				metricsData.EventsSent++
-				if err := sendToDestination(dest, payload, stream.Destination.Authentication); err != nil {
-					log.Printf("Stream '%s' (StreamID: '%s'): Failed to push data to destination. Error: %v", stream.Name, stream.StreamID, err)
-				}
 			}
+			metricsData.EventsSent += sent
+			metricsData.DeliveryErrors += failed
+			metricsData.BytesBeforeCompression += bytesBefore
+			metricsData.BytesAfterCompression += bytesAfter
+			metricsData.EventSequence = sender.sequence
 			metrics.Cache.Data[stream.StreamID] = metricsData
 			metrics.Cache.Unlock()
+
+			tickSpan.SetAttributes(attribute.Int("chunks_sent", sent), attribute.Int("chunks_failed", failed))
+			tracing.End(tickSpan, deliveryErr)
 		}
 	}
 }
 
-func handleDeduplication(stream *storage.QueryStream, payload []byte) bool {
-	// Compute hash of the payload
-	hash := fmt.Sprintf("%x", sha256.Sum256(payload))
+// newPinotClient builds the Pinot client for a stream, applying its
+// connection profile
+func newPinotClient(stream *storage.QueryStream) (*pinot.Client, error) {
+	config, err := connections.Resolve(stream.Pinot)
+	if err != nil {
+		return nil, err
+	}
 
-	dedupeStore.Lock()
-	defer dedupeStore.Unlock()
+	// Build the HTTP client with the configured TLS settings
+	httpClient, err := httpclient.New(config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Pinot TLS configuration: %w", err)
+	}
 
-	cache, exists := dedupeStore.Cache[stream.Name]
-	now := time.Now()
+	provider, err := auth.NewProvider(config.Authentication, config.Auth, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Pinot authentication: %w", err)
+	}
+	// Leave room for the broker to answer before its own query timeout
+	if timeout := time.Duration(config.Options.TimeoutMs)*time.Millisecond + time.Second; timeout > httpClient.Timeout {
+		httpClient.Timeout = timeout
+	}
+	client := pinot.NewClient(config.BrokerURL, httpClient, provider)
+	client.Options = config.Options
 
-	if exists {
-		// If hash is the same and within dedupe_duration, skip sending
-		if cache.Hash == hash && now.Sub(cache.LastSent) <= time.Duration(min(stream.Dedupe.Duration, 60000))*time.Millisecond {
-			log.Printf("Stream '%s': Duplicate data detected. Skipping push.", stream.StreamID)
-			return true
+	// Discover brokers from the controller when one is configured
+	if config.ControllerURL != "" {
+		table := config.Discovery.Table
+		if table == "" {
+			table = pinot.TableFromQuery(config.Query)
 		}
+		refresh := time.Duration(config.Discovery.RefreshInterval) * time.Millisecond
+		client.Pool = pinot.NewBrokerPool(config.ControllerURL, table, refresh, httpClient, provider)
 	}
+	return client, nil
+}
 
-	// Update dedupe cache with the new hash and timestamp
-	dedupeStore.Cache[stream.Name] = dedupeCache{
-		Hash:     hash,
-		LastSent: now,
+// recordError counts a failed or partial query and records it in the stream status
+func recordError(streamID string, err error, delivered bool) {
+	class := pinot.ErrorClass(err)
+	queryError := &models.QueryError{Class: class, Message: err.Error(), Delivered: delivered, At: time.Now()}
+	var queryErr *pinot.QueryError
+	if errors.As(err, &queryErr) {
+		queryError.Code = queryErr.Code
+	}
+
+	status.Update(streamID, func(current *models.StreamStatus) {
+		current.LastError = queryError
+		current.ConsecutiveErrors++
+	})
+
+	metrics.Cache.Lock()
+	defer metrics.Cache.Unlock()
+	metricsData := metrics.Cache.Data[streamID]
+	metricsData.QueryErrors++
+	if class == pinot.ErrorPartial {
+		metricsData.PartialResults++
+	}
+	// Replace the map rather than mutate it, since flushes copy entries shallowly
+	errorsByClass := map[string]int{class: 1}
+	for name, count := range metricsData.ErrorsByClass {
+		errorsByClass[name] += count
 	}
-	return false
+	metricsData.ErrorsByClass = errorsByClass
+	metrics.Cache.Data[streamID] = metricsData
 }
 
-func sendToDestination(dest destinations.Destination, payload []byte, authHeaders map[string]string) error {
-	// Create the HTTP request to the destination
-	req, err := http.NewRequest("POST", dest.GetURL(), bytes.NewBuffer(payload)) 
-	if err != nil {
-		return fmt.Errorf("failed to create destination request: %w", err)
+// recordSuccess records the time of a stream's last successful query
+func recordSuccess(streamID string) {
+	status.Update(streamID, func(current *models.StreamStatus) {
+		now := time.Now()
+		current.LastSuccessAt = &now
+	})
+}
+
+// run is the outcome of one tick of a worker
+type run struct {
+	started     time.Time
+	rows        int
+	queryErr    bool
+	noResult    bool
+	delivered   int
+	deliveryErr error
+}
+
+// recordRun records a tick in the stream status. A failed delivery counts
+// towards the error streak unless the query already did; a clean run ends it.
+func recordRun(streamID string, interval time.Duration, r run) {
+	status.Update(streamID, func(current *models.StreamStatus) {
+		now := time.Now()
+		next := r.started.Add(interval)
+		current.LastQueryAt = &r.started
+		current.NextRunAt = &next
+		if r.noResult {
+			return
+		}
+		current.LastRows = r.rows
+		if r.delivered > 0 {
+			current.LastDeliveryAt = &now
+		}
+		switch {
+		case r.deliveryErr != nil:
+			current.LastError = &models.QueryError{Class: "delivery", Message: r.deliveryErr.Error(), At: now}
+			if !r.queryErr {
+				current.ConsecutiveErrors++
+			}
+		case !r.queryErr:
+			current.ConsecutiveErrors = 0
+		}
+	})
+}
+
+// querySample extracts the execution statistics of a broker response
+func querySample(response *pinot.BrokerResponse) models.QuerySample {
+	return models.QuerySample{
+		At:                          time.Now(),
+		TimeUsedMs:                  response.TimeUsedMs,
+		NumDocsScanned:              response.NumDocsScanned,
+		NumEntriesScannedInFilter:   response.NumEntriesScannedInFilter,
+		NumEntriesScannedPostFilter: response.NumEntriesScannedPostFilter,
+		NumServersQueried:           response.NumServersQueried,
+		NumServersResponded:         response.NumServersResponded,
+		NumSegmentsQueried:          response.NumSegmentsQueried,
+		NumSegmentsProcessed:        response.NumSegmentsProcessed,
+		NumSegmentsMatched:          response.NumSegmentsMatched,
+		TotalDocs:                   response.TotalDocs,
+		NumRows:                     len(response.Rows()),
 	}
-	req.Header.Set("Content-Type", "application/json")
+}
+
+// recordBrokers publishes the discovered brokers in the stream status
+func recordBrokers(streamID string, brokers []pinot.Broker) {
+	status.Update(streamID, func(current *models.StreamStatus) {
+		current.Brokers = make([]models.BrokerStatus, len(brokers))
+		for i, broker := range brokers {
+			current.Brokers[i] = models.BrokerStatus{
+				URL:       broker.URL,
+				Instance:  broker.Instance,
+				Healthy:   broker.Healthy,
+				LastError: broker.LastError,
+				FailedAt:  broker.FailedAt,
+			}
+		}
+	})
+}
+
+// handleDeduplication reports whether payload repeats the last delivered
+// result within the dedupe window, and returns its hash for recordDelivered
+func handleDeduplication(stream *storage.QueryStream, payload []byte, logger *slog.Logger) (bool, string) {
+	// Compute hash of the payload
+	hash := fmt.Sprintf("%x", sha256.Sum256(payload))
+
+	dedupeStore.Lock()
+	defer dedupeStore.Unlock()
 
-	// Add authentication headers for the destination
-	for key, value := range authHeaders {
-		req.Header.Set(key, value)
+	cache, exists := dedupeStore.Cache[stream.StreamID]
+	if !exists {
+		// Pick up the state persisted before a restart
+		state, ok, err := storage.LoadDedupeState(stream.StreamID)
+		if err != nil {
+			logger.Error("Failed to load dedupe state", "error", err)
+		}
+		cache, exists = state, ok
+		if ok {
+			dedupeStore.Cache[stream.StreamID] = state
+		}
 	}
 
-	// Execute the request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send to destination: %w", err)
+	if exists {
+		// If hash is the same and within dedupe_duration, skip sending
+		if cache.Hash == hash && time.Since(cache.LastSent) <= min(time.Duration(stream.Dedupe.Duration)*time.Millisecond, time.Duration(config.Get().Dedupe.MaxDuration)) {
+			logger.Debug("Duplicate data detected, skipping push")
+			return true, hash
+		}
 	}
-	defer resp.Body.Close()
+	return false, hash
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("destination returned status %d", resp.StatusCode)
+// recordDelivered remembers the hash of a result once every chunk of it was
+// delivered, so a result that failed to deliver is sent again on the next tick
+func recordDelivered(stream *storage.QueryStream, hash string, logger *slog.Logger) {
+	state := models.DedupeState{
+		Hash:     hash,
+		LastSent: time.Now(),
 	}
 
-	return nil
+	dedupeStore.Lock()
+	defer dedupeStore.Unlock()
+	dedupeStore.Cache[stream.StreamID] = state
+	if err := storage.SaveDedupeState(stream.StreamID, state); err != nil {
+		logger.Error("Failed to persist dedupe state", "error", err)
+	}
 }
 
-func min(a, b int) int {
+func min(a, b time.Duration) time.Duration {
 	if a < b {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
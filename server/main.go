@@ -1,38 +1,186 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"qstreams/api"
+	"qstreams/internal/config"
 	"qstreams/internal/core"
+	"qstreams/internal/health"
+	"qstreams/internal/httpclient"
 	"qstreams/internal/metrics"
+	"qstreams/internal/secrets"
+	"qstreams/internal/storage"
+	"qstreams/internal/tracing"
+	"qstreams/internal/worker"
+	"qstreams/shared/utils"
 )
 
 func main() {
-	log.Println("Starting qstreams Server...")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+
+	// Load config/config.yaml with environment and flag overrides
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if err := utils.ConfigureLogger(cfg.Logging.Format, cfg.Logging.Level, cfg.Logging.BufferSize); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	slog.Info("Starting qstreams Server", "config", config.Path())
+	httpclient.DefaultTimeout = time.Duration(cfg.HTTP.Timeout)
+	shutdownTracing, err := tracing.Configure(cfg.Tracing.Exporter, cfg.Tracing.Endpoint, cfg.Tracing.SampleRatio)
+	if err != nil {
+		fatal("Invalid tracing configuration", err)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// Open the state store holding streams, connections and metrics
+	store, err := storage.Open(cfg.Store.Backend, cfg.Store.Path)
+	if err != nil {
+		fatal("Failed to open state store", err)
+	}
+	storage.SetStore(store)
+	health.MarkReady(health.StepStore)
+
+	// Load the key used to encrypt credentials at rest
+	secrets.Configure(cfg.Secrets.Key, cfg.Secrets.KeyFile)
+	if err := secrets.LoadKey(); err != nil {
+		fatal("Invalid secret key", err)
+	}
+	if !secrets.Enabled() {
+		slog.Warn("No secret key is configured; stream credentials are stored unencrypted")
+	}
+	if err := secrets.ConfigureReferences(cfg.Secrets.ReferenceDir); err != nil {
+		fatal("Invalid secret reference directory", err)
+	}
+
+	// Serve static files from the "console" folder
+	http.Handle("/console/", http.StripPrefix("/console/", http.FileServer(http.Dir(cfg.Server.ConsoleDir))))
+
+	// Initialize API routes
+	router := api.InitRoutes()
+	http.Handle("/", router)
+
+	// Start HTTP server once the store and secret key are loaded, so
+	// /healthz and /readyz answer while metrics and streams are restored;
+	// the API answers 503 until then
+	listener, err := net.Listen("tcp", cfg.Server.Address)
+	if err != nil {
+		fatal("Failed to listen", err)
+	}
+	slog.Info("Listening", "address", cfg.Server.Address)
+	server := &http.Server{}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
 
 	// Restore metrics from disk
 	if err := metrics.LoadMetrics(); err != nil {
-		log.Fatalf("Failed to restore metrics: %v", err)
+		fatal("Failed to restore metrics", err)
 	}
+	health.MarkReady(health.StepMetrics)
 
 	// Start periodic metrics flushing
-	go metrics.SaveMetricsFlush(30 * time.Second)
+	go metrics.SaveMetricsFlush(time.Duration(cfg.Metrics.FlushInterval))
+
+	// Roll up per-minute metrics history
+	go metrics.RunHistory(time.Duration(cfg.Metrics.MinuteRetention), time.Duration(cfg.Metrics.HourRetention))
 
 	// Restore streams
 	if err := core.RestoreStreams(); err != nil {
-		log.Fatalf("Failed to restore streams: %v", err)
+		fatal("Failed to restore streams", err)
 	}
+	health.MarkReady(health.StepStreams)
+	slog.Info("Server is ready")
 
-	// Serve static files from the "console" folder
-	http.Handle("/console/", http.StripPrefix("/console/", http.FileServer(http.Dir("./console"))))
+	// Export batched spans before exiting on a signal or a server error
+	select {
+	case err := <-served:
+		flushTraces(shutdownTracing)
+		fatal("HTTP server stopped", err)
+	case sig := <-stop:
+		slog.Info("Shutting down", "signal", sig.String())
+		shutdown(server)
+		flushTraces(shutdownTracing)
+		if err := store.Close(); err != nil {
+			slog.Error("Failed to close state store", "error", err)
+		}
+	}
+}
 
-	// Initialize API routes
-	router := api.InitRoutes()
-	http.Handle("/", router)
+// shutdownTimeout bounds how long shutdown waits for in-flight ticks and requests
+const shutdownTimeout = 30 * time.Second
+
+// shutdown stops the workers so no counters change after the final metrics
+// flush, then stops the HTTP server once in-flight requests finish
+func shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := worker.StopWorkers(ctx); err != nil {
+		slog.Error("Stream workers did not stop in time", "error", err)
+	}
+	if err := metrics.Flush(); err != nil {
+		slog.Error("Failed to flush metrics", "error", err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down HTTP server", "error", err)
+	}
+}
 
-	// Start HTTP server
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
\ No newline at end of file
+// flushTraces waits up to five seconds for batched spans to be exported
+func flushTraces(shutdown func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+}
+
+// fatal logs err and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
+
+// migrate copies all state from one store backend to another, e.g.
+//
+//	server migrate -from file -from-path . -to bolt -to-path qstreams.db
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fromBackend := flags.String("from", storage.BackendFile, "source store backend")
+	fromPath := flags.String("from-path", "", "source state directory or database file")
+	toBackend := flags.String("to", storage.BackendBolt, "target store backend")
+	toPath := flags.String("to-path", "", "target state directory or database file")
+	flags.Parse(args)
+
+	from, err := storage.Open(*fromBackend, *fromPath)
+	if err != nil {
+		fatal("Failed to open source store", err)
+	}
+	defer from.Close()
+
+	to, err := storage.Open(*toBackend, *toPath)
+	if err != nil {
+		fatal("Failed to open target store", err)
+	}
+	defer to.Close()
+
+	if err := storage.Migrate(from, to); err != nil {
+		fatal("Migration failed", err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package signature signs and verifies qstreams webhook deliveries.
+//
+// Every signed delivery carries a unique id and a signature header:
+//
+//	X-QStreams-Delivery-Id: 8f14e45fceea167a5a36dedd4bea2543
+//	X-QStreams-Signature: t=1700000000,v1=5257a869...,v1=9f3e11b2...
+//
+// where t is the unix timestamp at which the delivery was signed and each v1
+// is a hex encoded HMAC-SHA256 of "<t>.<id>.<body>" computed with one of the
+// stream's active secrets. Two secrets are active while a secret is being
+// rotated, so receivers holding either secret can verify the delivery.
+//
+// Receivers import this package and call Verifier.Verify (or VerifyRequest)
+// to check the signature and reject stale or replayed deliveries. Replays are
+// recognised by the signed id, so identical bodies sent within the same
+// second are both accepted.
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderName is the default header carrying the signature.
+	HeaderName = "X-QStreams-Signature"
+
+	// IDHeaderName is the header carrying the delivery id.
+	IDHeaderName = "X-QStreams-Delivery-Id"
+
+	// Scheme is the version tag of signatures produced by this package.
+	Scheme = "v1"
+
+	// DefaultTolerance is the maximum accepted age of a signed delivery.
+	DefaultTolerance = 5 * time.Minute
+
+	// MaxSecrets is the number of secrets that may be active at once.
+	MaxSecrets = 2
+
+	secretPrefix = "whsec_"
+)
+
+var (
+	ErrInvalidHeader     = errors.New("signature: invalid signature header")
+	ErrNoSignatures      = errors.New("signature: no v1 signatures in header")
+	ErrNoDeliveryID      = errors.New("signature: missing delivery id")
+	ErrTimestampExpired  = errors.New("signature: timestamp outside the tolerance window")
+	ErrSignatureMismatch = errors.New("signature: no signature matches the expected value")
+	ErrReplayed          = errors.New("signature: delivery has already been received")
+)
+
+// NewSecret returns a random signing secret suitable for a stream destination.
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("signature: failed to generate secret: %w", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewDeliveryID returns a random id for one delivery request.
+func NewDeliveryID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("signature: failed to generate delivery id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Compute returns the hex encoded HMAC-SHA256 of "<timestamp>.<id>.<payload>".
+func Compute(payload []byte, secret, id string, timestamp time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(id))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Header builds the signature header value for the delivery id and payload,
+// with one v1 entry per secret in the order given.
+func Header(payload []byte, secrets []string, id string, timestamp time.Time) string {
+	parts := make([]string, 0, len(secrets)+1)
+	parts = append(parts, "t="+strconv.FormatInt(timestamp.Unix(), 10))
+	for _, secret := range secrets {
+		parts = append(parts, Scheme+"="+Compute(payload, secret, id, timestamp))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Parse splits a signature header into its timestamp and v1 signatures.
+func Parse(header string) (time.Time, []string, error) {
+	var (
+		timestamp  time.Time
+		haveTime   bool
+		signatures []string
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return time.Time{}, nil, ErrInvalidHeader
+		}
+		switch key {
+		case "t":
+			secs, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return time.Time{}, nil, ErrInvalidHeader
+			}
+			timestamp = time.Unix(secs, 0)
+			haveTime = true
+		case Scheme:
+			signatures = append(signatures, value)
+		}
+	}
+	if !haveTime {
+		return time.Time{}, nil, ErrInvalidHeader
+	}
+	if len(signatures) == 0 {
+		return time.Time{}, nil, ErrNoSignatures
+	}
+	return timestamp, signatures, nil
+}
+
+// Verifier checks signed deliveries on the receiving side. The zero value is
+// not usable; set at least one secret. Replay protection remembers every
+// accepted delivery id until it falls out of the tolerance window, so a single
+// Verifier should be shared by all requests for a given endpoint.
+type Verifier struct {
+	// Secrets lists the secrets the receiver accepts. During rotation this
+	// holds both the new and the previous secret.
+	Secrets []string
+
+	// Header is the header VerifyRequest reads the signature from, matching
+	// the stream's signing.header. Defaults to HeaderName.
+	Header string
+
+	// Tolerance is the maximum age of a delivery. Defaults to DefaultTolerance.
+	Tolerance time.Duration
+
+	// AllowReplays disables replay detection.
+	AllowReplays bool
+
+	// Now overrides the clock, mainly for tests.
+	Now func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewVerifier returns a Verifier accepting any of the given secrets.
+func NewVerifier(secrets ...string) *Verifier {
+	return &Verifier{Secrets: secrets}
+}
+
+// Verify checks header against the delivery id and payload. It returns nil
+// only if the timestamp is within the tolerance window, at least one signature
+// matches one of the configured secrets and the id has not been seen before.
+func (v *Verifier) Verify(payload []byte, header, id string) error {
+	timestamp, signatures, err := Parse(header)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return ErrNoDeliveryID
+	}
+
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	if age := now.Sub(timestamp); age > tolerance || age < -tolerance {
+		return ErrTimestampExpired
+	}
+
+	var matched string
+	for _, secret := range v.Secrets {
+		expected := Compute(payload, secret, id, timestamp)
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(expected), []byte(signature)) {
+				matched = expected
+				break
+			}
+		}
+		if matched != "" {
+			break
+		}
+	}
+	if matched == "" {
+		return ErrSignatureMismatch
+	}
+
+	if v.AllowReplays {
+		return nil
+	}
+	return v.remember(id, timestamp, now, tolerance)
+}
+
+// VerifyRequest reads and verifies the body of r, returning the body so the
+// caller can decode it. The request body is replaced so it can be read again.
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("signature: failed to read request body: %w", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := v.Header
+	if header == "" {
+		header = HeaderName
+	}
+	if err := v.Verify(body, r.Header.Get(header), r.Header.Get(IDHeaderName)); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (v *Verifier) remember(id string, timestamp, now time.Time, tolerance time.Duration) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+	for key, ts := range v.seen {
+		if now.Sub(ts) > tolerance {
+			delete(v.seen, key)
+		}
+	}
+	if _, exists := v.seen[id]; exists {
+		return ErrReplayed
+	}
+	v.seen[id] = timestamp
+	return nil
+}
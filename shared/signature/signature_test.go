@@ -0,0 +1,168 @@
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"rows":[[1,"a"]]}`)
+
+	tests := []struct {
+		name      string
+		accept    []string
+		sign      []string
+		signedAt  time.Time
+		id        string
+		payload   []byte
+		tolerance time.Duration
+		want      error
+	}{
+		{name: "valid", accept: []string{"new"}, sign: []string{"new"}, signedAt: now, id: "a"},
+		{name: "receiver has previous secret during rotation", accept: []string{"old"}, sign: []string{"new", "old"}, signedAt: now, id: "a"},
+		{name: "receiver has new secret during rotation", accept: []string{"new"}, sign: []string{"new", "old"}, signedAt: now, id: "a"},
+		{name: "receiver accepts both secrets", accept: []string{"new", "old"}, sign: []string{"old"}, signedAt: now, id: "a"},
+		{name: "unknown secret", accept: []string{"other"}, sign: []string{"new", "old"}, signedAt: now, id: "a", want: ErrSignatureMismatch},
+		{name: "tampered body", accept: []string{"new"}, sign: []string{"new"}, signedAt: now, id: "a", payload: []byte(`{"rows":[[2,"a"]]}`), want: ErrSignatureMismatch},
+		{name: "within tolerance", accept: []string{"new"}, sign: []string{"new"}, signedAt: now.Add(-4 * time.Minute), id: "a"},
+		{name: "too old", accept: []string{"new"}, sign: []string{"new"}, signedAt: now.Add(-6 * time.Minute), id: "a", want: ErrTimestampExpired},
+		{name: "too far in the future", accept: []string{"new"}, sign: []string{"new"}, signedAt: now.Add(6 * time.Minute), id: "a", want: ErrTimestampExpired},
+		{name: "custom tolerance", accept: []string{"new"}, sign: []string{"new"}, signedAt: now.Add(-time.Minute), id: "a", tolerance: 30 * time.Second, want: ErrTimestampExpired},
+		{name: "missing id", accept: []string{"new"}, sign: []string{"new"}, signedAt: now, want: ErrNoDeliveryID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &Verifier{Secrets: tt.accept, Tolerance: tt.tolerance, Now: func() time.Time { return now }}
+			header := Header(body, tt.sign, tt.id, tt.signedAt)
+			payload := body
+			if tt.payload != nil {
+				payload = tt.payload
+			}
+			if err := verifier.Verify(payload, header, tt.id); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedID(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload")
+	verifier := &Verifier{Secrets: []string{"secret"}, Now: func() time.Time { return now }}
+
+	// Changing the id to get past replay detection invalidates the signature
+	header := Header(body, []string{"secret"}, "a", now)
+	if err := verifier.Verify(body, header, "b"); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Verify() with a different id = %v, want %v", err, ErrSignatureMismatch)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload")
+
+	tests := []struct {
+		name         string
+		ids          []string
+		allowReplays bool
+		want         []error
+	}{
+		{name: "identical bodies with distinct ids", ids: []string{"a", "b"}, want: []error{nil, nil}},
+		{name: "replayed id", ids: []string{"a", "a"}, want: []error{nil, ErrReplayed}},
+		{name: "replays allowed", ids: []string{"a", "a"}, allowReplays: true, want: []error{nil, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &Verifier{Secrets: []string{"secret"}, AllowReplays: tt.allowReplays, Now: func() time.Time { return now }}
+			for i, id := range tt.ids {
+				header := Header(body, []string{"secret"}, id, now)
+				if err := verifier.Verify(body, header, id); !errors.Is(err, tt.want[i]) {
+					t.Errorf("delivery %d: Verify() = %v, want %v", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyReplayForgottenAfterTolerance(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload")
+	verifier := &Verifier{Secrets: []string{"secret"}, Now: func() time.Time { return now }}
+
+	if err := verifier.Verify(body, Header(body, []string{"secret"}, "a", now), "a"); err != nil {
+		t.Fatalf("first delivery: %v", err)
+	}
+	now = now.Add(DefaultTolerance + time.Second)
+	if len(verifier.seen) != 1 {
+		t.Fatalf("seen holds %d ids, want 1", len(verifier.seen))
+	}
+	verifier.Verify(body, Header(body, []string{"secret"}, "b", now), "b")
+	if _, ok := verifier.seen["a"]; ok {
+		t.Errorf("id older than the tolerance window is still remembered")
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"ok":true}`)
+
+	tests := []struct {
+		name   string
+		header string
+		sentAs string
+		want   error
+	}{
+		{name: "default header", sentAs: HeaderName},
+		{name: "custom header", header: "X-Custom-Signature", sentAs: "X-Custom-Signature"},
+		{name: "custom header expected, default sent", header: "X-Custom-Signature", sentAs: HeaderName, want: ErrInvalidHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &Verifier{Secrets: []string{"secret"}, Header: tt.header}
+			req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+			req.Header.Set(IDHeaderName, "delivery-1")
+			req.Header.Set(tt.sentAs, Header(body, []string{"secret"}, "delivery-1", now))
+
+			got, err := verifier.VerifyRequest(req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyRequest() = %v, want %v", err, tt.want)
+			}
+			if err == nil && !bytes.Equal(got, body) {
+				t.Errorf("VerifyRequest() body = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		signatures int
+		want       error
+	}{
+		{name: "two signatures", header: "t=1700000000,v1=aa,v1=bb", signatures: 2},
+		{name: "unknown scheme ignored", header: "t=1700000000,v0=aa,v1=bb", signatures: 1},
+		{name: "missing timestamp", header: "v1=aa", want: ErrInvalidHeader},
+		{name: "bad timestamp", header: "t=soon,v1=aa", want: ErrInvalidHeader},
+		{name: "no signatures", header: "t=1700000000", want: ErrNoSignatures},
+		{name: "malformed part", header: "t=1700000000,v1", want: ErrInvalidHeader},
+		{name: "empty", header: "", want: ErrInvalidHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, signatures, err := Parse(tt.header)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Parse() = %v, want %v", err, tt.want)
+			}
+			if len(signatures) != tt.signatures {
+				t.Errorf("Parse() returned %d signatures, want %d", len(signatures), tt.signatures)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field names shared by every log line about a stream
+const (
+	FieldStreamID    = "stream_id"
+	FieldStreamName  = "stream_name"
+	FieldBroker      = "broker"
+	FieldDestination = "destination"
+	FieldAttempt     = "attempt"
+)
+
+// DefaultLogBufferSize is the number of recent log lines kept per stream
+const DefaultLogBufferSize = 500
+
+// LogEntry is a log line kept in a stream's ring buffer
+type LogEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+var level = new(slog.LevelVar)
+
+var streamLevels = struct {
+	sync.RWMutex
+	levels map[string]slog.Level
+}{levels: make(map[string]slog.Level)}
+
+var buffers = struct {
+	sync.Mutex
+	size    int
+	entries map[string]*logRing
+}{size: DefaultLogBufferSize, entries: make(map[string]*logRing)}
+
+var root = struct {
+	sync.RWMutex
+	base slog.Handler
+}{base: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})}
+
+func init() {
+	slog.SetDefault(slog.New(&handler{}))
+}
+
+// ConfigureLogger sets the output format ("text" or "json"), the global
+// level and the number of lines kept per stream. Messages written with the
+// standard log package go through the same handler.
+func ConfigureLogger(format, levelName string, bufferSize int) error {
+	parsed, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var base slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		base = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		base = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("unknown log format %q (expected 'text' or 'json')", format)
+	}
+
+	root.Lock()
+	root.base = base
+	root.Unlock()
+	level.Set(parsed)
+	if bufferSize > 0 {
+		buffers.Lock()
+		buffers.size = bufferSize
+		buffers.Unlock()
+	}
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var parsed slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(name)); err != nil {
+		return parsed, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+	}
+	return parsed, nil
+}
+
+// SetStreamLevel overrides the global level for one stream. An empty level
+// removes the override.
+func SetStreamLevel(streamID, levelName string) error {
+	streamLevels.Lock()
+	defer streamLevels.Unlock()
+	if levelName == "" {
+		delete(streamLevels.levels, streamID)
+		return nil
+	}
+	parsed, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	streamLevels.levels[streamID] = parsed
+	return nil
+}
+
+// StreamLogger returns a logger that tags lines with the stream's ID and
+// name, honours its level override and keeps its recent lines for StreamLogs
+func StreamLogger(streamID, streamName string) *slog.Logger {
+	return slog.New(&handler{streamID: streamID}).With(FieldStreamID, streamID, FieldStreamName, streamName)
+}
+
+// StreamLogs returns up to limit of a stream's most recent log lines, oldest first
+func StreamLogs(streamID string, limit int) []LogEntry {
+	buffers.Lock()
+	defer buffers.Unlock()
+	ring, ok := buffers.entries[streamID]
+	if !ok {
+		return []LogEntry{}
+	}
+	return ring.recent(limit)
+}
+
+// DeleteStreamLogs drops a stream's log buffer and level override
+func DeleteStreamLogs(streamID string) {
+	buffers.Lock()
+	delete(buffers.entries, streamID)
+	buffers.Unlock()
+	SetStreamLevel(streamID, "")
+}
+
+// handler writes to the configured output and, for stream loggers, copies
+// each line into the stream's ring buffer
+type handler struct {
+	streamID string
+	// attrs are copied to the ring buffer; scopes replays WithAttrs and
+	// WithGroup calls on the output handler, in order
+	attrs  []slog.Attr
+	scopes []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	if h.streamID != "" {
+		streamLevels.RLock()
+		override, ok := streamLevels.levels[h.streamID]
+		streamLevels.RUnlock()
+		if ok {
+			return l >= override
+		}
+	}
+	return l >= level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if h.streamID != "" {
+		h.keep(record)
+	}
+
+	root.RLock()
+	base := root.base
+	root.RUnlock()
+	for _, scope := range h.scopes {
+		base = scope(base)
+	}
+	return base.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	copied := *h
+	copied.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	copied.scopes = append(append([]func(slog.Handler) slog.Handler{}, h.scopes...), func(base slog.Handler) slog.Handler {
+		return base.WithAttrs(attrs)
+	})
+	return &copied
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	copied := *h
+	copied.scopes = append(append([]func(slog.Handler) slog.Handler{}, h.scopes...), func(base slog.Handler) slog.Handler {
+		return base.WithGroup(name)
+	})
+	return &copied
+}
+
+// keep adds a record to the stream's ring buffer. Stream ID and name are
+// left out since every line in the buffer shares them.
+func (h *handler) keep(record slog.Record) {
+	entry := LogEntry{Time: record.Time, Level: record.Level.String(), Message: record.Message}
+	add := func(attr slog.Attr) bool {
+		if attr.Key == FieldStreamID || attr.Key == FieldStreamName {
+			return true
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]interface{})
+		}
+		value := attr.Value.Resolve()
+		if err, ok := value.Any().(error); ok {
+			entry.Fields[attr.Key] = err.Error()
+		} else {
+			entry.Fields[attr.Key] = value.Any()
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		add(attr)
+	}
+	record.Attrs(add)
+
+	buffers.Lock()
+	defer buffers.Unlock()
+	ring, ok := buffers.entries[h.streamID]
+	if !ok {
+		ring = &logRing{entries: make([]LogEntry, buffers.size)}
+		buffers.entries[h.streamID] = ring
+	}
+	ring.add(entry)
+}
+
+type logRing struct {
+	entries []LogEntry
+	next    int
+	count   int
+}
+
+func (r *logRing) add(entry LogEntry) {
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.count < len(r.entries) {
+		r.count++
+	}
+}
+
+func (r *logRing) recent(limit int) []LogEntry {
+	if limit <= 0 || limit > r.count {
+		limit = r.count
+	}
+	recent := make([]LogEntry, limit)
+	start := r.next - limit
+	if start < 0 {
+		start += len(r.entries)
+	}
+	for i := range recent {
+		recent[i] = r.entries[(start+i)%len(r.entries)]
+	}
+	return recent
+}